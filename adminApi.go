@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/logger"
+	"trace-monitor-collector/traceCollection"
+
+	"gopkg.in/yaml.v2"
+)
+
+var adminHandler http.Handler
+
+// newAdminHandler закрывает /admin/ учётными данными admin_access.
+// Без них возвращает nil и /admin/ не обслуживается: эти методы очищают хранилище и включают trace логирование сырых пакетов
+func newAdminHandler(cfg *config.Config) (http.Handler, error) {
+	if !cfg.AdminAccess.HasCredentials() {
+		return nil, nil
+	}
+	return withAccessControl(cfg.AdminAccess, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveAdmin(w, r, cfg)
+	}))
+}
+
+func serveAdmin(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	switch r.URL.Path {
+	case "/admin/log-level":
+		serveLogLevel(w, r)
+	case "/admin/config":
+		if requireMethod(w, r, http.MethodGet) {
+			serveAdminConfig(w, cfg)
+		}
+	case "/admin/evict":
+		if requireMethod(w, r, http.MethodPost) {
+			serveAdminEvict(w, r, cfg)
+		}
+	case "/admin/clear":
+		if requireMethod(w, r, http.MethodPost) {
+			evicted := traceCollection.Clear()
+			httpLog.Warn("trace store cleared", "evicted", evicted, "remote", r.RemoteAddr)
+			writeAdminJson(w, map[string]interface{}{"evicted": evicted})
+		}
+	case "/admin/reset-counters":
+		if requireMethod(w, r, http.MethodPost) {
+			resetCounters()
+			httpLog.Warn("counters reset", "remote", r.RemoteAddr)
+			writeAdminJson(w, map[string]interface{}{"status": "ok"})
+		}
+	case "/admin/fpm-check":
+		if requireMethod(w, r, http.MethodPost) {
+			serveAdminFpmCheck(w, cfg)
+		}
+	default:
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+	}
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeAdminJson(w http.ResponseWriter, response interface{}) {
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		httpLog.Error("encoding JSON", "err", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+// serveLogLevel показывает уровни логирования и меняет их без перезапуска.
+// level=default возвращает подсистеме общий уровень.
+func serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		query := r.URL.Query()
+		subsystem := query.Get("subsystem")
+		if subsystem != "" && !isKnownSubsystem(subsystem) {
+			http.Error(w, "Unknown subsystem", http.StatusBadRequest)
+			return
+		}
+		if subsystem != "" && query.Get("level") == "default" {
+			logger.ResetSubsystemLevel(subsystem)
+			break
+		}
+		level, err := logger.ParseLevel(query.Get("level"))
+		if err != nil {
+			http.Error(w, "Invalid level", http.StatusBadRequest)
+			return
+		}
+		if subsystem == "" {
+			logger.SetLevel(level)
+		} else {
+			logger.SetSubsystemLevel(subsystem, level)
+		}
+		httpLog.Warn("log level changed", "subsystem", subsystem, "level", level, "remote", r.RemoteAddr)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeAdminJson(w, map[string]interface{}{
+		"level":      logger.GetLevel().String(),
+		"subsystems": logger.Levels(),
+	})
+}
+
+func isKnownSubsystem(subsystem string) bool {
+	for _, knownSubsystem := range logger.Subsystems() {
+		if knownSubsystem == subsystem {
+			return true
+		}
+	}
+	return false
+}
+
+// serveAdminConfig отдаёт действующий конфиг с учётом значений по умолчанию и флагов, секреты замаскированы
+func serveAdminConfig(w http.ResponseWriter, cfg *config.Config) {
+	yamlBytes, err := yaml.Marshal(cfg.Masked())
+	if err != nil {
+		http.Error(w, "Config encoding error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	w.Write(yamlBytes)
+}
+
+// serveAdminEvict удаляет трейс процесса (pid и при необходимости app, host) или трейс по traceId
+func serveAdminEvict(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	query := r.URL.Query()
+	var evicted []string
+	if traceId := query.Get("traceId"); traceId != "" {
+		evicted = traceCollection.EvictTrace(traceId)
+	} else if pid := query.Get("pid"); pid != "" {
+		app := query.Get("app")
+		if app == cfg.AppName {
+			app = ""
+		}
+		key := traceCollection.ProcessKey(app, query.Get("host"), pid)
+		if traceCollection.EvictProcess(key) {
+			evicted = []string{key}
+		}
+	} else {
+		http.Error(w, "pid or traceId is required", http.StatusBadRequest)
+		return
+	}
+	if len(evicted) == 0 {
+		http.Error(w, "Trace not found", http.StatusNotFound)
+		return
+	}
+	httpLog.Warn("traces evicted", "keys", evicted, "remote", r.RemoteAddr)
+	writeAdminJson(w, map[string]interface{}{"evicted": evicted})
+}
+
+func serveAdminFpmCheck(w http.ResponseWriter, cfg *config.Config) {
+	timeout := cfg.HttpClientTimeout * time.Second
+	for _, source := range cfg.FpmStatusSources {
+		timeout += source.Timeout * time.Second
+	}
+	result, isDone := requestFpmCheck(timeout + time.Second)
+	if !isDone {
+		http.Error(w, "FPM status check timed out", http.StatusGatewayTimeout)
+		return
+	}
+	writeAdminJson(w, result)
+}
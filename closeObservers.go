@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/failures"
+	"trace-monitor-collector/normalize"
+	"trace-monitor-collector/retention"
+	"trace-monitor-collector/stats"
+	"trace-monitor-collector/traceCollection"
+)
+
+var (
+	failedTraceStore   *failures.Store
+	droppedTraceStore  *failures.Store
+	retentionPolicy    *retention.Policy
+	retainedTraceStore *retention.Store
+)
+
+func registerCloseObservers(cfg *config.Config) {
+	traceTagLabels = newTagLabelSet(cfg.MetricsTagLabels, cfg.MetricsTagMaxValues)
+	stats.Spans = stats.NewAggregator(cfg.StatsMaxKeys)
+	stats.Uris = stats.NewAggregator(cfg.StatsMaxKeys)
+	stats.Queries = stats.NewAggregator(cfg.StatsMaxKeys)
+	queryDuration = newQueryDurationHistogram(cfg)
+	queryFingerprintLimiter = newLabelLimiter(cfg.QueryMetricsMaxKeys)
+	traceErrors = newTraceErrorsCounter(cfg)
+	errorSpanLimiter = newLabelLimiter(cfg.ErrorMetricsMaxKeys)
+	errorClassLimiter = newLabelLimiter(cfg.ErrorMetricsMaxKeys)
+	traceDuration = newTraceDurationHistogram(cfg)
+	failedTraceStore = failures.New(cfg.FailedTracesKeep)
+	droppedTraceStore = failures.New(cfg.FailedTracesKeep)
+	droppedTraces = newDroppedTracesCounter(cfg)
+	if cfg.Retention.Keep > 0 && retentionPolicy != nil {
+		retainedTraceStore = retention.NewStore(cfg.Retention.Keep)
+	}
+
+	traceCollection.OnSpanClose(func(span traceCollection.ClosedSpan) {
+		now := time.Now()
+		stats.Spans.Observe(span.Name, span.Duration, now)
+		kind, fingerprint := spanFingerprint(span.Context)
+		if fingerprint == "" {
+			return
+		}
+		stats.Queries.Observe(kind+": "+fingerprint, span.Duration, now)
+		// Спан закрывается раньше трейса, решения retention ещё нет, поэтому exemplar ставится всегда: ссылка работает,
+		// пока трейс открыт. Откладывать наблюдение до закрытия трейса нельзя, метрики долгих трейсов отставали бы
+		observeWithTraceId(cfg, queryDuration.WithLabelValues(appNameOf(cfg, span.App), kind, queryFingerprintLimiter.Allow(fingerprint)), span.Duration.Seconds(), span.TraceId)
+	})
+	traceCollection.OnTraceError(func(recordedError traceCollection.RecordedError) {
+		labelValues := []string{appNameOf(cfg, recordedError.App), errorSpanLimiter.Allow(recordedError.Error.Span), errorClassLimiter.Allow(recordedError.Error.Class)}
+		traceErrors.WithLabelValues(append(labelValues, traceTagLabels.Values(recordedError.TagValues)...)...).Inc()
+	})
+	traceCollection.OnTraceDrop(func(trace traceCollection.ClosedTrace) {
+		observeTraceDrop(cfg, trace)
+	})
+	traceCollection.OnTraceClose(func(trace traceCollection.ClosedTrace) {
+		isRetained := false
+		if retainedTraceStore != nil {
+			if isKept, rule := retentionPolicy.Decide(trace); isKept {
+				retainedTraceStore.Add(retention.NewTrace(trace, rule))
+				isRetained = true
+			}
+		}
+		var tags map[string]interface{}
+		if traceTagLabels.Len() > 0 && trace.Tags != nil {
+			json.Unmarshal(trace.Tags, &tags)
+		}
+		labelValues := append([]string{appNameOf(cfg, trace.App)}, traceTagLabels.Values(tags)...)
+		// Закрытый трейс доступен в /trace/by-id, только если его сохранила retention, иначе exemplar вёл бы в 404
+		if isRetained {
+			observeWithTraceId(cfg, traceDuration.WithLabelValues(labelValues...), trace.Duration.Seconds(), trace.TraceId)
+		} else {
+			traceDuration.WithLabelValues(labelValues...).Observe(trace.Duration.Seconds())
+		}
+		if len(trace.Errors) > 0 {
+			failures.TotalFailedTraces.Increment()
+			failedTraceStore.Add(failedTraceOf(trace))
+		}
+		if trace.Uri == "" {
+			return
+		}
+		stats.Uris.Observe(stats.NormalizeUri(trace.Method, trace.Uri), trace.Duration, time.Now())
+	})
+}
+
+// Трейсы, удалённые без free-pid, чаще всего означают fatal error в PHP, поэтому попадают в /errors отдельным списком.
+// Вытеснение по лимитам хранилища ничего не говорит о процессе и при наплыве pid вытеснило бы из списка полезные трейсы, его только считаем
+func observeTraceDrop(cfg *config.Config, trace traceCollection.ClosedTrace) {
+	droppedTraces.WithLabelValues(appNameOf(cfg, trace.App), trace.DropReason).Inc()
+	if trace.DropReason == traceCollection.DropReasonEvicted {
+		return
+	}
+	droppedTraceStore.Add(failedTraceOf(trace))
+}
+
+func failedTraceOf(trace traceCollection.ClosedTrace) failures.Trace {
+	return failures.Trace{
+		App:        trace.App,
+		Host:       trace.Host,
+		Pid:        trace.Pid,
+		TraceId:    trace.TraceId,
+		Method:     trace.Method,
+		Uri:        trace.Uri,
+		DurationMs: trace.Duration.Milliseconds(),
+		ClosedAt:   trace.ClosedAt,
+		Errors:     trace.Errors,
+		Reason:     trace.DropReason,
+		Tags:       trace.Tags,
+		Context:    trace.Context,
+	}
+}
+
+func spanFingerprint(context map[string]interface{}) (string, string) {
+	if query, ok := context["query"].(string); ok {
+		return "sql", normalize.SQL(query)
+	}
+	if commandID, ok := context["commandID"].(string); ok {
+		arguments, _ := context["arguments"].([]interface{})
+		return "redis", normalize.Redis(commandID, arguments)
+	}
+	return "", ""
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/failures"
+	"trace-monitor-collector/traceCollection"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpanFingerprintDetectsSqlAndRedisSpans(t *testing.T) {
+	// Arrange
+	sqlContext := map[string]interface{}{"query": `select * from "rent" where "car_id" = ? limit 1`, "bindings": []interface{}{9123}}
+	redisContext := map[string]interface{}{"commandID": "get", "arguments": []interface{}{"rent.cache:car_address:9123"}}
+	otherContext := map[string]interface{}{"url": "http://example.com"}
+
+	// Act
+	sqlKind, sqlFingerprint := spanFingerprint(sqlContext)
+	redisKind, redisFingerprint := spanFingerprint(redisContext)
+	otherKind, otherFingerprint := spanFingerprint(otherContext)
+
+	// Assert
+	assert.Equal(t, "sql", sqlKind)
+	assert.Equal(t, `select * from "rent" where "car_id" = ? limit ?`, sqlFingerprint)
+	assert.Equal(t, "redis", redisKind)
+	assert.Equal(t, "GET rent.cache:car_address:{id}", redisFingerprint)
+	assert.Empty(t, otherKind)
+	assert.Empty(t, otherFingerprint)
+}
+
+func TestLabelLimiterBoundsCardinality(t *testing.T) {
+	// Arrange
+	limiter := newLabelLimiter(2)
+
+	// Act & Assert
+	assert.Equal(t, "a", limiter.Allow("a"))
+	assert.Equal(t, "b", limiter.Allow("b"))
+	assert.Equal(t, overflowLabelValue, limiter.Allow("c"))
+	assert.Equal(t, "a", limiter.Allow("a"))
+}
+
+func TestObserveWithTraceIdAttachesExemplarOnlyWhenEnabled(t *testing.T) {
+	// Arrange
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "duration_seconds", Buckets: []float64{1, 10}})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(histogram)
+	enabledCfg := &config.Config{MetricsExemplars: true}
+	disabledCfg := &config.Config{}
+
+	// Act
+	observeWithTraceId(disabledCfg, histogram, 0.5, "fast-trace")
+	observeWithTraceId(enabledCfg, histogram, 5, "slow-trace")
+	observeWithTraceId(enabledCfg, histogram, 7, strings.Repeat("x", prometheus.ExemplarMaxRunes))
+	families, err := registry.Gather()
+
+	// Assert
+	require.Nil(t, err)
+	buckets := families[0].GetMetric()[0].GetHistogram().GetBucket()
+	assert.Equal(t, uint64(3), families[0].GetMetric()[0].GetHistogram().GetSampleCount())
+	assert.Nil(t, buckets[0].GetExemplar())
+	require.NotNil(t, buckets[1].GetExemplar())
+	assert.Equal(t, "traceId", buckets[1].GetExemplar().GetLabel()[0].GetName())
+	assert.Equal(t, "slow-trace", buckets[1].GetExemplar().GetLabel()[0].GetValue())
+	assert.Equal(t, 5.0, buckets[1].GetExemplar().GetValue())
+}
+
+func TestQueryDurationIsLabelledWithSpanApp(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{AppName: "app-name"}
+	histogram := newQueryDurationHistogram(cfg)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(histogram)
+
+	// Act
+	histogram.WithLabelValues(appNameOf(cfg, "billing"), "sql", "select ?").Observe(0.01)
+	histogram.WithLabelValues(appNameOf(cfg, ""), "sql", "select ?").Observe(0.01)
+	families, err := registry.Gather()
+
+	// Assert
+	require.Nil(t, err)
+	var apps []string
+	for _, metric := range families[0].GetMetric() {
+		apps = append(apps, labelsOf(metric)["app"])
+	}
+	assert.ElementsMatch(t, []string{"billing", "app-name"}, apps)
+}
+
+func TestObserveTraceDropKeepsDropsApartFromFailedTraces(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{AppName: "app-name"}
+	previousDroppedTraces, previousDroppedTraceStore := droppedTraces, droppedTraceStore
+	defer func() {
+		droppedTraces, droppedTraceStore = previousDroppedTraces, previousDroppedTraceStore
+	}()
+	droppedTraces = newDroppedTracesCounter(cfg)
+	droppedTraceStore = failures.New(10)
+	failedBefore := failures.TotalFailedTraces.Count()
+
+	// Act
+	observeTraceDrop(cfg, traceCollection.ClosedTrace{TraceId: "hung-trace", DropReason: traceCollection.DropReasonHung})
+	observeTraceDrop(cfg, traceCollection.ClosedTrace{TraceId: "evicted-trace", DropReason: traceCollection.DropReasonEvicted})
+
+	// Assert
+	dropped := droppedTraceStore.List()
+	require.Len(t, dropped, 1)
+	assert.Equal(t, "hung-trace", dropped[0].TraceId)
+	assert.Equal(t, traceCollection.DropReasonHung, dropped[0].Reason)
+	assert.Equal(t, failedBefore, failures.TotalFailedTraces.Count())
+	assert.Equal(t, 1.0, testutil.ToFloat64(droppedTraces.WithLabelValues("app-name", traceCollection.DropReasonEvicted)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(droppedTraces.WithLabelValues("app-name", traceCollection.DropReasonHung)))
+}
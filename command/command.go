@@ -12,13 +12,27 @@ var (
 	ErrorEmptyJson = errors.New("FromJson: empty json")
 )
 
+// Error описывает исключение: поле data у trace-error или поле error у закрытия span и free-pid
+type Error struct {
+	Class     string          `json:"class"`
+	Message   string          `json:"message"`
+	Backtrace json.RawMessage `json:"backtrace,omitempty"`
+	Span      string          `json:"span,omitempty"`
+}
+
 type Command struct {
 	Pid        string          `json:"pid"`
 	Method     string          `json:"method"`
 	TraceId    string          `json:"traceId"`
 	Data       json.RawMessage `json:"data"`
 	SentAt     time.Time       `json:"sentAt"`
+	Seq        uint64          `json:"seq,omitempty"`
+	App        string          `json:"app,omitempty"`
+	Host       string          `json:"host,omitempty"`
+	Error      *Error          `json:"error,omitempty"`
 	RawCommand []byte          `json:"-"`
+	ReceivedAt time.Time       `json:"-"`
+	Source     string          `json:"-"`
 }
 
 func FromJson(js []byte) (Command, error) {
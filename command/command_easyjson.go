@@ -17,7 +17,96 @@ var (
 	_ easyjson.Marshaler
 )
 
-func easyjson36cb9bedDecodeTraceMonitorCollectorCommand(in *jlexer.Lexer, out *Command) {
+func easyjson36cb9bedDecodeTraceMonitorCollectorCommand(in *jlexer.Lexer, out *Error) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "class":
+			out.Class = string(in.String())
+		case "message":
+			out.Message = string(in.String())
+		case "backtrace":
+			if data := in.Raw(); in.Ok() {
+				in.AddError((out.Backtrace).UnmarshalJSON(data))
+			}
+		case "span":
+			out.Span = string(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson36cb9bedEncodeTraceMonitorCollectorCommand(out *jwriter.Writer, in Error) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"class\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.Class))
+	}
+	{
+		const prefix string = ",\"message\":"
+		out.RawString(prefix)
+		out.String(string(in.Message))
+	}
+	if len(in.Backtrace) != 0 {
+		const prefix string = ",\"backtrace\":"
+		out.RawString(prefix)
+		out.Raw((in.Backtrace).MarshalJSON())
+	}
+	if in.Span != "" {
+		const prefix string = ",\"span\":"
+		out.RawString(prefix)
+		out.String(string(in.Span))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v Error) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson36cb9bedEncodeTraceMonitorCollectorCommand(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v Error) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson36cb9bedEncodeTraceMonitorCollectorCommand(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *Error) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson36cb9bedDecodeTraceMonitorCollectorCommand(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *Error) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson36cb9bedDecodeTraceMonitorCollectorCommand(l, v)
+}
+func easyjson36cb9bedDecodeTraceMonitorCollectorCommand1(in *jlexer.Lexer, out *Command) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -50,6 +139,22 @@ func easyjson36cb9bedDecodeTraceMonitorCollectorCommand(in *jlexer.Lexer, out *C
 			if data := in.Raw(); in.Ok() {
 				in.AddError((out.SentAt).UnmarshalJSON(data))
 			}
+		case "seq":
+			out.Seq = uint64(in.Uint64())
+		case "app":
+			out.App = string(in.String())
+		case "host":
+			out.Host = string(in.String())
+		case "error":
+			if in.IsNull() {
+				in.Skip()
+				out.Error = nil
+			} else {
+				if out.Error == nil {
+					out.Error = new(Error)
+				}
+				(*out.Error).UnmarshalEasyJSON(in)
+			}
 		default:
 			in.SkipRecursive()
 		}
@@ -60,7 +165,7 @@ func easyjson36cb9bedDecodeTraceMonitorCollectorCommand(in *jlexer.Lexer, out *C
 		in.Consumed()
 	}
 }
-func easyjson36cb9bedEncodeTraceMonitorCollectorCommand(out *jwriter.Writer, in Command) {
+func easyjson36cb9bedEncodeTraceMonitorCollectorCommand1(out *jwriter.Writer, in Command) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -89,29 +194,49 @@ func easyjson36cb9bedEncodeTraceMonitorCollectorCommand(out *jwriter.Writer, in
 		out.RawString(prefix)
 		out.Raw((in.SentAt).MarshalJSON())
 	}
+	if in.Seq != 0 {
+		const prefix string = ",\"seq\":"
+		out.RawString(prefix)
+		out.Uint64(uint64(in.Seq))
+	}
+	if in.App != "" {
+		const prefix string = ",\"app\":"
+		out.RawString(prefix)
+		out.String(string(in.App))
+	}
+	if in.Host != "" {
+		const prefix string = ",\"host\":"
+		out.RawString(prefix)
+		out.String(string(in.Host))
+	}
+	if in.Error != nil {
+		const prefix string = ",\"error\":"
+		out.RawString(prefix)
+		(*in.Error).MarshalEasyJSON(out)
+	}
 	out.RawByte('}')
 }
 
 // MarshalJSON supports json.Marshaler interface
 func (v Command) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjson36cb9bedEncodeTraceMonitorCollectorCommand(&w, v)
+	easyjson36cb9bedEncodeTraceMonitorCollectorCommand1(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
 func (v Command) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjson36cb9bedEncodeTraceMonitorCollectorCommand(w, v)
+	easyjson36cb9bedEncodeTraceMonitorCollectorCommand1(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
 func (v *Command) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjson36cb9bedDecodeTraceMonitorCollectorCommand(&r, v)
+	easyjson36cb9bedDecodeTraceMonitorCollectorCommand1(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
 func (v *Command) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjson36cb9bedDecodeTraceMonitorCollectorCommand(l, v)
+	easyjson36cb9bedDecodeTraceMonitorCollectorCommand1(l, v)
 }
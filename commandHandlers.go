@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"trace-monitor-collector/command"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+	"trace-monitor-collector/traceCollection"
+)
+
+type commandHandlerFunc func(cfg *config.Config, pid string, cmd command.Command) error
+
+type commandHandler struct {
+	apply commandHandlerFunc
+	total counter.CounterStruct
+}
+
+// Значение метки method для методов без обработчика, зарегистрировать обработчик с этим именем нельзя
+const unknownCommandMethod = "_unknown"
+
+var (
+	commandHandlersMu   sync.RWMutex
+	commandHandlers     = defaultCommandHandlers()
+	totalUnknownCommand counter.CounterStruct
+)
+
+// registerCommandHandler добавляет или заменяет обработчик метода UDP пакета
+func registerCommandHandler(method string, apply commandHandlerFunc) {
+	if method == unknownCommandMethod {
+		panic("command method " + unknownCommandMethod + " is reserved for methods without a handler")
+	}
+	commandHandlersMu.Lock()
+	defer commandHandlersMu.Unlock()
+	commandHandlers[method] = &commandHandler{apply: apply}
+}
+
+func defaultCommandHandlers() map[string]*commandHandler {
+	handlers := make(map[string]*commandHandler)
+	register := func(method string, apply commandHandlerFunc) {
+		handlers[method] = &commandHandler{apply: apply}
+	}
+	register("init-trace", func(cfg *config.Config, pid string, cmd command.Command) error {
+		return traceCollection.InitTrace(cfg, pid, cmd.TraceId, cmd.SentAt, cmd.ReceivedAt, cmd.Seq, cmd.RawCommand)
+	})
+	register("set-trace-current-span", func(cfg *config.Config, pid string, cmd command.Command) error {
+		if cmd.Data == nil {
+			return traceCollection.DeleteSpan(cfg, pid, cmd.TraceId, cmd.SentAt, cmd.Seq)
+		}
+		return traceCollection.SetTraceCurrentSpan(cfg, pid, cmd.TraceId, cmd.SentAt, cmd.ReceivedAt, cmd.Seq, cmd.RawCommand)
+	})
+	register("free-pid", func(cfg *config.Config, pid string, cmd command.Command) error {
+		return traceCollection.DeleteTrace(cfg, pid, cmd.TraceId, cmd.SentAt, cmd.Seq)
+	})
+	register("set-trace-tags", func(cfg *config.Config, pid string, cmd command.Command) error {
+		return traceCollection.SetTraceTags(cfg, pid, cmd.TraceId, cmd.RawCommand)
+	})
+	register("add-trace-context", func(cfg *config.Config, pid string, cmd command.Command) error {
+		return traceCollection.AddTraceContext(cfg, pid, cmd.TraceId, cmd.RawCommand)
+	})
+	addTraceEvent := func(cfg *config.Config, pid string, cmd command.Command) error {
+		return traceCollection.AddTraceEvent(cfg, pid, cmd.TraceId, cmd.Method, cmd.SentAt, cmd.RawCommand)
+	}
+	register("span-event", addTraceEvent)
+	register("log", addTraceEvent)
+	register("trace-error", func(cfg *config.Config, pid string, cmd command.Command) error {
+		var packet struct {
+			Data command.Error `json:"data"`
+		}
+		if err := json.Unmarshal(cmd.RawCommand, &packet); err != nil {
+			return fmt.Errorf("skip trace-error command. %v", err)
+		}
+		return traceCollection.AddTraceError(cfg, pid, cmd.TraceId, traceErrorOf(packet.Data, cmd))
+	})
+
+	return handlers
+}
+
+func applyCommandToCollection(cfg *config.Config, cmd command.Command) error {
+	commandHandlersMu.RLock()
+	handler, isExist := commandHandlers[cmd.Method]
+	commandHandlersMu.RUnlock()
+	if !isExist {
+		totalUnknownCommand.Increment()
+		return fmt.Errorf("unknown method specified in UDP packet. %v", cmd.Method)
+	}
+	handler.total.Increment()
+	// Ошибку в закрытии span или free-pid записываем до применения, пока трейс и текущий span ещё на месте
+	if cmd.Error != nil && cmd.Method != "trace-error" {
+		if err := traceCollection.AddTraceError(cfg, processKeyOf(cmd), cmd.TraceId, traceErrorOf(*cmd.Error, cmd)); err != nil {
+			udpLog.WarnLimited("trace-error", "trace error not recorded", "pid", cmd.Pid, "traceId", cmd.TraceId, "err", err)
+		}
+	}
+
+	return handler.apply(cfg, processKeyOf(cmd), cmd)
+}
+
+func traceErrorOf(commandError command.Error, cmd command.Command) traceCollection.TraceError {
+	return traceCollection.TraceError{
+		Class:     commandError.Class,
+		Message:   commandError.Message,
+		Backtrace: commandError.Backtrace,
+		Span:      commandError.Span,
+		SentAt:    cmd.SentAt,
+	}
+}
+
+func countCommandsByMethod() map[string]uint64 {
+	commandHandlersMu.RLock()
+	defer commandHandlersMu.RUnlock()
+	countByMethod := make(map[string]uint64, len(commandHandlers))
+	for method, handler := range commandHandlers {
+		countByMethod[method] = handler.total.Count()
+	}
+	return countByMethod
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"trace-monitor-collector/command"
+	"trace-monitor-collector/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyCommandToCollectionDispatchesByMethod(t *testing.T) {
+	// Arrange
+	var appliedPid string
+	registerCommandHandler("test-method", func(cfg *config.Config, pid string, cmd command.Command) error {
+		appliedPid = pid
+		return nil
+	})
+	cfg := &config.Config{}
+	unknownBefore := totalUnknownCommand.Count()
+
+	// Act
+	err := applyCommandToCollection(cfg, command.Command{Pid: "700", App: "billing", Method: "test-method"})
+	unknownErr := applyCommandToCollection(cfg, command.Command{Pid: "700", Method: "no-such-method"})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "billing//700", appliedPid)
+	assert.NotNil(t, unknownErr)
+	assert.Equal(t, unknownBefore+1, totalUnknownCommand.Count())
+	assert.Equal(t, uint64(1), countCommandsByMethod()["test-method"])
+	assert.Contains(t, countCommandsByMethod(), "set-trace-tags")
+}
+
+func TestRegisterCommandHandlerRejectsReservedUnknownMethod(t *testing.T) {
+	// Act & Assert
+	assert.Panics(t, func() {
+		registerCommandHandler(unknownCommandMethod, func(cfg *config.Config, pid string, cmd command.Command) error {
+			return nil
+		})
+	})
+	assert.NotContains(t, countCommandsByMethod(), unknownCommandMethod)
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -9,39 +10,143 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
-type Config struct {
-	Env                  string        `yaml:"env"`
-	UdpPortRange         string        `yaml:"udp_port_range"`
-	HttpAddr             string        `yaml:"http_addr"`
-	FpmStatusURL         string        `yaml:"fpm_status_url"`
-	HttpClientTimeout    time.Duration `yaml:"http_client_timeout"`
-	LoadFpmStatusTimeout time.Duration `yaml:"load_fpm_status_timeout"`
+type FpmStatusSource struct {
+	Name                  string            `yaml:"name"`
+	App                   string            `yaml:"app"`
+	Host                  string            `yaml:"host"`
+	URL                   string            `yaml:"url"`
+	Timeout               time.Duration     `yaml:"timeout"`
+	TlsInsecureSkipVerify bool              `yaml:"tls_insecure_skip_verify"`
+	TlsCaFile             string            `yaml:"tls_ca_file"`
+	TlsCertFile           string            `yaml:"tls_cert_file"`
+	TlsKeyFile            string            `yaml:"tls_key_file"`
+	TlsServerName         string            `yaml:"tls_server_name"`
+	BasicAuthUser         string            `yaml:"basic_auth_user"`
+	BasicAuthPassword     string            `yaml:"basic_auth_password"`
+	BearerToken           string            `yaml:"bearer_token"`
+	Headers               map[string]string `yaml:"headers"`
+	FastcgiAddress        string            `yaml:"fastcgi_address"`
+	FastcgiStatusPath     string            `yaml:"fastcgi_status_path"`
+	FastcgiQuery          string            `yaml:"fastcgi_query"`
+}
+
+type HttpAccess struct {
+	BearerTokens []string          `yaml:"bearer_tokens"`
+	BasicUsers   map[string]string `yaml:"basic_users"`
+	AllowIps     []string          `yaml:"allow_ips"`
+}
+
+type Redaction struct {
+	OnIngestion bool     `yaml:"on_ingestion"`
+	OnOutput    bool     `yaml:"on_output"`
+	Keys        []string `yaml:"keys"`
+	Paths       []string `yaml:"paths"`
+	Patterns    []string `yaml:"patterns"`
+	Mask        string   `yaml:"mask"`
+}
+
+type HeadSampleRule struct {
+	App     string  `yaml:"app"`
+	Tag     string  `yaml:"tag"`
+	Percent float64 `yaml:"percent"`
+}
+
+type TailRule struct {
+	Name          string `yaml:"name"`
+	MinDurationMs int    `yaml:"min_duration_ms"`
+	HasError      bool   `yaml:"has_error"`
+	SpanName      string `yaml:"span_name"`
+}
+
+type Retention struct {
+	Keep              int              `yaml:"keep"`
+	HeadSamplePercent float64          `yaml:"head_sample_percent"`
+	HeadSampling      []HeadSampleRule `yaml:"head_sampling"`
+	TailRules         []TailRule       `yaml:"tail_rules"`
+}
+
+// MetricsPush настраивает периодическую отправку метрик для хостов, которые нельзя скрейпить
+type MetricsPush struct {
+	Interval          time.Duration `yaml:"interval"`
+	Timeout           time.Duration `yaml:"timeout"`
+	PushgatewayURL    string        `yaml:"pushgateway_url"`
+	PushgatewayJob    string        `yaml:"pushgateway_job"`
+	RemoteWriteURL    string        `yaml:"remote_write_url"`
+	BasicAuthUser     string        `yaml:"basic_auth_user"`
+	BasicAuthPassword string        `yaml:"basic_auth_password"`
+	BearerToken       string        `yaml:"bearer_token"`
+	StatsdAddress     string        `yaml:"statsd_address"`
+	StatsdFormat      string        `yaml:"statsd_format"`
+	StatsdPrefix      string        `yaml:"statsd_prefix"`
+}
+
+// IsEnabled сообщает, задан ли хотя бы один получатель метрик
+func (p MetricsPush) IsEnabled() bool {
+	return p.PushgatewayURL != "" || p.RemoteWriteURL != "" || p.StatsdAddress != ""
+}
+
+type AppConfig struct {
 	StuckProcessDuration time.Duration `yaml:"stuck_process_duration"`
-	Buffer               int           `yaml:"buffer"`
-	PacketsSize          int           `yaml:"packets_size"`
-	AppName              string        `yaml:"app_name"`
+}
+
+type Config struct {
+	Env                  string               `yaml:"env"`
+	UdpPortRange         string               `yaml:"udp_port_range"`
+	HttpAddr             string               `yaml:"http_addr"`
+	HttpAccess           HttpAccess           `yaml:"http_access"`
+	HttpTlsCertFile      string               `yaml:"http_tls_cert_file"`
+	HttpTlsKeyFile       string               `yaml:"http_tls_key_file"`
+	MetricsAddr          string               `yaml:"metrics_addr"`
+	MetricsAccess        HttpAccess           `yaml:"metrics_access"`
+	AdminAccess          HttpAccess           `yaml:"admin_access"`
+	FpmStatusURL         string               `yaml:"fpm_status_url"`
+	FpmStatusInsecure    bool                 `yaml:"fpm_status_tls_insecure_skip_verify"`
+	FpmStatusSources     []FpmStatusSource    `yaml:"fpm_status_sources"`
+	HttpClientTimeout    time.Duration        `yaml:"http_client_timeout"`
+	LoadFpmStatusTimeout time.Duration        `yaml:"load_fpm_status_timeout"`
+	StuckProcessDuration time.Duration        `yaml:"stuck_process_duration"`
+	Buffer               int                  `yaml:"buffer"`
+	PacketsSize          int                  `yaml:"packets_size"`
+	AppName              string               `yaml:"app_name"`
+	ProcRoot             string               `yaml:"proc_root"`
+	PidLivenessCheck     bool                 `yaml:"pid_liveness_check"`
+	PidLivenessInterval  time.Duration        `yaml:"pid_liveness_interval"`
+	Redaction            Redaction            `yaml:"redaction"`
+	StreamBuffer         int                  `yaml:"stream_buffer"`
+	ReorderWindowMs      int                  `yaml:"reorder_window_ms"`
+	StatsMaxKeys         int                  `yaml:"stats_max_keys"`
+	QueryMetricsMaxKeys  int                  `yaml:"query_metrics_max_keys"`
+	ClockSkewWarnMs      int                  `yaml:"clock_skew_warn_ms"`
+	UseReceiveTime       bool                 `yaml:"use_receive_time"`
+	Apps                 map[string]AppConfig `yaml:"apps"`
+	FailedTracesKeep     int                  `yaml:"failed_traces_keep"`
+	ErrorMetricsMaxKeys  int                  `yaml:"error_metrics_max_keys"`
+	FpmUriMetricsMaxKeys int                  `yaml:"fpm_uri_metrics_max_keys"`
+	Retention            Retention            `yaml:"retention"`
+	StoreMaxEntries      int                  `yaml:"store_max_entries"`
+	StoreMaxBytes        int64                `yaml:"store_max_bytes"`
+	MaxFieldBytes        int                  `yaml:"max_field_bytes"`
+	TruncateFields       []string             `yaml:"truncate_fields"`
+	LogLevel             string               `yaml:"log_level"`
+	LogFormat            string               `yaml:"log_format"`
+	LogWarnInterval      time.Duration        `yaml:"log_warn_interval"`
+	MetricsLabels        map[string]string    `yaml:"metrics_labels"`
+	MetricsTagLabels     []string             `yaml:"metrics_tag_labels"`
+	MetricsTagMaxValues  int                  `yaml:"metrics_tag_max_values"`
+	MetricsPush          MetricsPush          `yaml:"metrics_push"`
+	MetricsExemplars     bool                 `yaml:"metrics_exemplars"`
 	LayoutTime           string
 	UdpPortStart         int
 	UdpPortEnd           int
 	UdpPortRangeCount    int
-
-	verbosity int
 }
 
-func (c *Config) SetVerbosity(isVerbose, isVeryVerbose, isVeryVeryVerbose bool) {
-	if isVeryVeryVerbose {
-		c.verbosity = 3
-	}
-	if isVeryVerbose {
-		c.verbosity = 2
+// StuckProcessDurationByApp возвращает порог зависания с учётом настроек приложения из envelope
+func (c *Config) StuckProcessDurationByApp(app string) time.Duration {
+	if appConfig, isExist := c.Apps[app]; isExist && appConfig.StuckProcessDuration != 0 {
+		return appConfig.StuckProcessDuration * time.Second
 	}
-	if isVerbose {
-		c.verbosity = 1
-	}
-}
-
-func (c *Config) IsVerboseByLevel(verboseLevel string) bool {
-	return c.verbosity >= len(verboseLevel)
+	return c.StuckProcessDuration * time.Second
 }
 
 func LoadFromFile(filePath string) (*Config, error) {
@@ -60,6 +165,162 @@ func LoadFromFile(filePath string) (*Config, error) {
 	cfg.UdpPortStart, _ = strconv.Atoi(portRange[0])
 	cfg.UdpPortEnd, _ = strconv.Atoi(portRange[1])
 	cfg.UdpPortRangeCount = cfg.UdpPortEnd - cfg.UdpPortStart + 1
+	if cfg.ProcRoot == "" {
+		cfg.ProcRoot = "/proc"
+	}
+	if cfg.PidLivenessInterval == 0 {
+		cfg.PidLivenessInterval = 1
+	}
+	if cfg.QueryMetricsMaxKeys == 0 {
+		cfg.QueryMetricsMaxKeys = 200
+	}
+	if cfg.ClockSkewWarnMs == 0 {
+		cfg.ClockSkewWarnMs = 1000
+	}
+	if cfg.FailedTracesKeep == 0 {
+		cfg.FailedTracesKeep = 100
+	}
+	if cfg.ErrorMetricsMaxKeys == 0 {
+		cfg.ErrorMetricsMaxKeys = 200
+	}
+	if cfg.FpmUriMetricsMaxKeys == 0 {
+		cfg.FpmUriMetricsMaxKeys = 200
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "warn"
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = "logfmt"
+	}
+	if cfg.LogWarnInterval == 0 {
+		cfg.LogWarnInterval = 10
+	}
+	if cfg.MetricsTagMaxValues == 0 {
+		cfg.MetricsTagMaxValues = 100
+	}
+	if cfg.MetricsPush.Interval == 0 {
+		cfg.MetricsPush.Interval = 15
+	}
+	if cfg.MetricsPush.Timeout == 0 {
+		cfg.MetricsPush.Timeout = 5
+	}
+	if cfg.MetricsPush.PushgatewayJob == "" {
+		cfg.MetricsPush.PushgatewayJob = "trace_monitor_collector"
+	}
+	if cfg.MetricsPush.StatsdFormat == "" {
+		cfg.MetricsPush.StatsdFormat = "dogstatsd"
+	}
+	if len(cfg.TruncateFields) == 0 {
+		cfg.TruncateFields = []string{"debugTrace"}
+	}
+	if cfg.StreamBuffer == 0 {
+		cfg.StreamBuffer = 256
+	}
+	if cfg.Redaction.Mask == "" {
+		cfg.Redaction.Mask = "***"
+	}
+	if len(cfg.FpmStatusSources) == 0 && cfg.FpmStatusURL != "" {
+		cfg.FpmStatusSources = []FpmStatusSource{{
+			Name:                  "default",
+			URL:                   cfg.FpmStatusURL,
+			TlsInsecureSkipVerify: cfg.FpmStatusInsecure,
+		}}
+	}
+	for i := range cfg.FpmStatusSources {
+		if cfg.FpmStatusSources[i].Name == "" {
+			cfg.FpmStatusSources[i].Name = cfg.FpmStatusSources[i].URL
+		}
+		if cfg.FpmStatusSources[i].Name == "" {
+			cfg.FpmStatusSources[i].Name = cfg.FpmStatusSources[i].FastcgiAddress
+		}
+		if cfg.FpmStatusSources[i].FastcgiStatusPath == "" {
+			cfg.FpmStatusSources[i].FastcgiStatusPath = "/fpm-status"
+		}
+		if cfg.FpmStatusSources[i].FastcgiQuery == "" {
+			cfg.FpmStatusSources[i].FastcgiQuery = "json&full"
+		}
+		if cfg.FpmStatusSources[i].Timeout == 0 {
+			cfg.FpmStatusSources[i].Timeout = cfg.HttpClientTimeout
+		}
+	}
 
 	return &cfg, nil
 }
+
+// Masked возвращает копию конфига для показа через /admin/config: пароли, токены и учётные данные в URL заменены маской
+func (c *Config) Masked() Config {
+	mask := c.Redaction.Mask
+	if mask == "" {
+		mask = "***"
+	}
+	masked := *c
+	masked.HttpAccess = c.HttpAccess.masked(mask)
+	masked.MetricsAccess = c.MetricsAccess.masked(mask)
+	masked.AdminAccess = c.AdminAccess.masked(mask)
+	masked.FpmStatusURL = maskURL(c.FpmStatusURL, mask)
+	masked.FpmStatusSources = make([]FpmStatusSource, len(c.FpmStatusSources))
+	for i, source := range c.FpmStatusSources {
+		source.URL = maskURL(source.URL, mask)
+		if source.BasicAuthPassword != "" {
+			source.BasicAuthPassword = mask
+		}
+		if source.BearerToken != "" {
+			source.BearerToken = mask
+		}
+		if source.Headers != nil {
+			headers := make(map[string]string, len(source.Headers))
+			for name, value := range source.Headers {
+				if isSecretHeader(name) {
+					value = mask
+				}
+				headers[name] = value
+			}
+			source.Headers = headers
+		}
+		masked.FpmStatusSources[i] = source
+	}
+	masked.MetricsPush.PushgatewayURL = maskURL(c.MetricsPush.PushgatewayURL, mask)
+	masked.MetricsPush.RemoteWriteURL = maskURL(c.MetricsPush.RemoteWriteURL, mask)
+	if c.MetricsPush.BasicAuthPassword != "" {
+		masked.MetricsPush.BasicAuthPassword = mask
+	}
+	if c.MetricsPush.BearerToken != "" {
+		masked.MetricsPush.BearerToken = mask
+	}
+	return masked
+}
+
+// HasCredentials сообщает, заданы ли токены или пользователи: одного списка IP недостаточно
+func (a HttpAccess) HasCredentials() bool {
+	return len(a.BearerTokens) > 0 || len(a.BasicUsers) > 0
+}
+
+func (a HttpAccess) masked(mask string) HttpAccess {
+	masked := HttpAccess{AllowIps: a.AllowIps}
+	for range a.BearerTokens {
+		masked.BearerTokens = append(masked.BearerTokens, mask)
+	}
+	if a.BasicUsers != nil {
+		masked.BasicUsers = make(map[string]string, len(a.BasicUsers))
+		for user := range a.BasicUsers {
+			masked.BasicUsers[user] = mask
+		}
+	}
+	return masked
+}
+
+func maskURL(rawURL string, mask string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.User == nil {
+		return rawURL
+	}
+	if _, hasPassword := parsedURL.User.Password(); hasPassword {
+		parsedURL.User = url.UserPassword(parsedURL.User.Username(), mask)
+	}
+	return parsedURL.String()
+}
+
+func isSecretHeader(name string) bool {
+	name = strings.ToLower(name)
+	return name == "authorization" || name == "cookie" || strings.Contains(name, "token") || strings.Contains(name, "secret")
+}
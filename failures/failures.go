@@ -0,0 +1,68 @@
+package failures
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+	"trace-monitor-collector/counter"
+	"trace-monitor-collector/traceCollection"
+)
+
+var (
+	TotalFailedTraces counter.CounterStruct
+)
+
+type Trace struct {
+	App        string                       `json:"app,omitempty"`
+	Host       string                       `json:"host,omitempty"`
+	Pid        string                       `json:"pid"`
+	TraceId    string                       `json:"traceId"`
+	Method     string                       `json:"method,omitempty"`
+	Uri        string                       `json:"uri,omitempty"`
+	DurationMs int64                        `json:"durationMs"`
+	ClosedAt   time.Time                    `json:"closedAt"`
+	Errors     []traceCollection.TraceError `json:"errors"`
+	Reason     string                       `json:"reason,omitempty"`
+	Tags       json.RawMessage              `json:"tags,omitempty"`
+	Context    json.RawMessage              `json:"context,omitempty"`
+}
+
+// Store хранит последние size трейсов в кольцевом буфере
+type Store struct {
+	mu     sync.Mutex
+	traces []Trace
+	next   int
+	size   int
+}
+
+func New(size int) *Store {
+	return &Store{
+		traces: make([]Trace, 0, size),
+		size:   size,
+	}
+}
+
+func (s *Store) Add(trace Trace) {
+	if s.size <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.traces) < s.size {
+		s.traces = append(s.traces, trace)
+		return
+	}
+	s.traces[s.next] = trace
+	s.next = (s.next + 1) % s.size
+}
+
+// List возвращает трейсы от новых к старым
+func (s *Store) List() []Trace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Trace, 0, len(s.traces))
+	for i := len(s.traces) - 1; i >= 0; i-- {
+		result = append(result, s.traces[(s.next+i)%len(s.traces)])
+	}
+	return result
+}
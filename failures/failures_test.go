@@ -0,0 +1,25 @@
+package failures_test
+
+import (
+	"testing"
+	"trace-monitor-collector/failures"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListReturnsLastTracesNewestFirst(t *testing.T) {
+	// Arrange
+	store := failures.New(3)
+
+	// Act
+	for _, traceId := range []string{"1", "2", "3", "4", "5"} {
+		store.Add(failures.Trace{TraceId: traceId})
+	}
+
+	// Assert
+	traces := store.List()
+	assert.Len(t, traces, 3)
+	assert.Equal(t, "5", traces[0].TraceId)
+	assert.Equal(t, "4", traces[1].TraceId)
+	assert.Equal(t, "3", traces[2].TraceId)
+}
@@ -0,0 +1,119 @@
+package fpmClient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+	"trace-monitor-collector/config"
+)
+
+var (
+	ErrorInvalidCaFile  = errors.New("fpmClient: no certificates found in CA file")
+	ErrorEmptyAddress   = errors.New("fpmClient: neither url nor fastcgi_address is set")
+	ErrorUnexpectedCode = errors.New("fpmClient: unexpected status code")
+)
+
+type Client struct {
+	source     config.FpmStatusSource
+	httpClient *http.Client
+}
+
+func New(source config.FpmStatusSource) (*Client, error) {
+	if source.URL == "" && source.FastcgiAddress == "" {
+		return nil, ErrorEmptyAddress
+	}
+	client := &Client{source: source}
+	if source.FastcgiAddress != "" {
+		return client, nil
+	}
+
+	tlsConfig, err := buildTlsConfig(source)
+	if err != nil {
+		return nil, err
+	}
+	client.httpClient = &http.Client{
+		Timeout: source.Timeout * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	return client, nil
+}
+
+func buildTlsConfig(source config.FpmStatusSource) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: source.TlsInsecureSkipVerify,
+		ServerName:         source.TlsServerName,
+	}
+	if source.TlsCaFile != "" {
+		caBytes, err := os.ReadFile(source.TlsCaFile)
+		if err != nil {
+			return nil, err
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(caBytes) {
+			return nil, ErrorInvalidCaFile
+		}
+		tlsConfig.RootCAs = certPool
+	}
+	if source.TlsCertFile != "" || source.TlsKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(source.TlsCertFile, source.TlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (c *Client) Name() string {
+	return c.source.Name
+}
+
+func (c *Client) Source() config.FpmStatusSource {
+	return c.source
+}
+
+func (c *Client) LoadStatus() ([]byte, error) {
+	if c.source.FastcgiAddress != "" {
+		return c.loadStatusFastcgi()
+	}
+	return c.loadStatusHttp()
+}
+
+func (c *Client) loadStatusHttp() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, c.source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range c.source.Headers {
+		req.Header.Set(name, value)
+	}
+	if c.source.BasicAuthUser != "" {
+		req.SetBasicAuth(c.source.BasicAuthUser, c.source.BasicAuthPassword)
+	}
+	if c.source.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.source.BearerToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("%w: %d", ErrorUnexpectedCode, resp.StatusCode)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,165 @@
+package fpmClient_test
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/fpmClient"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fpmStatusBody = `{"pool":"www","processes":[{"pid":101,"state":"Running"}]}`
+
+func TestLoadStatusSendsAuthAndCustomHeaders(t *testing.T) {
+	// Arrange
+	var receivedRequest *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedRequest = r
+		w.Write([]byte(fpmStatusBody))
+	}))
+	defer server.Close()
+	client, err := fpmClient.New(config.FpmStatusSource{
+		Name:        "www",
+		URL:         server.URL + "/fpm-status?json&full",
+		Timeout:     1,
+		BearerToken: "secret-token",
+		Headers:     map[string]string{"Host": "status.local", "X-Pool": "www"},
+	})
+	require.Nil(t, err)
+
+	// Act
+	body, err := client.LoadStatus()
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, fpmStatusBody, string(body))
+	assert.Equal(t, "Bearer secret-token", receivedRequest.Header.Get("Authorization"))
+	assert.Equal(t, "www", receivedRequest.Header.Get("X-Pool"))
+}
+
+func TestLoadStatusSendsBasicAuth(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "monitor" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(fpmStatusBody))
+	}))
+	defer server.Close()
+	source := config.FpmStatusSource{URL: server.URL, Timeout: 1, BasicAuthUser: "monitor", BasicAuthPassword: "pass"}
+	client, err := fpmClient.New(source)
+	require.Nil(t, err)
+	source.BasicAuthPassword = "wrong"
+	wrongClient, err := fpmClient.New(source)
+	require.Nil(t, err)
+
+	// Act
+	body, err := client.LoadStatus()
+	_, wrongErr := wrongClient.LoadStatus()
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, fpmStatusBody, string(body))
+	assert.ErrorIs(t, wrongErr, fpmClient.ErrorUnexpectedCode)
+}
+
+func TestLoadStatusVerifiesServerWithCaBundle(t *testing.T) {
+	// Arrange
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fpmStatusBody))
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.Nil(t, os.WriteFile(caFile, caPem, 0o644))
+	trustedClient, err := fpmClient.New(config.FpmStatusSource{URL: server.URL, Timeout: 1, TlsCaFile: caFile})
+	require.Nil(t, err)
+	untrustedClient, err := fpmClient.New(config.FpmStatusSource{URL: server.URL, Timeout: 1})
+	require.Nil(t, err)
+
+	// Act
+	body, err := trustedClient.LoadStatus()
+	_, untrustedErr := untrustedClient.LoadStatus()
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, fpmStatusBody, string(body))
+	assert.NotNil(t, untrustedErr)
+}
+
+func TestNewReturnsErrorWhenCaFileHasNoCertificates(t *testing.T) {
+	// Arrange
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.Nil(t, os.WriteFile(caFile, []byte("not a certificate"), 0o644))
+
+	// Act
+	_, err := fpmClient.New(config.FpmStatusSource{URL: "https://127.0.0.1", TlsCaFile: caFile})
+
+	// Assert
+	assert.ErrorIs(t, err, fpmClient.ErrorInvalidCaFile)
+}
+
+func TestLoadStatusTalksToFastcgiServerDirectly(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+	var receivedPath, receivedQuery string
+	go fcgi.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPath = r.URL.Path
+		receivedQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(fpmStatusBody))
+	}))
+	client, err := fpmClient.New(config.FpmStatusSource{
+		Name:              "www",
+		Timeout:           1,
+		FastcgiAddress:    listener.Addr().String(),
+		FastcgiStatusPath: "/fpm-status",
+		FastcgiQuery:      "json&full",
+	})
+	require.Nil(t, err)
+
+	// Act
+	body, err := client.LoadStatus()
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, fpmStatusBody, string(body))
+	assert.Equal(t, "/fpm-status", receivedPath)
+	assert.Equal(t, "json&full", receivedQuery)
+}
+
+func TestLoadStatusReturnsErrorWhenFastcgiStatusIsNotOk(t *testing.T) {
+	// Arrange
+	socketPath := filepath.Join(t.TempDir(), "fpm.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.Nil(t, err)
+	defer listener.Close()
+	go fcgi.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Access denied.", http.StatusForbidden)
+	}))
+	client, err := fpmClient.New(config.FpmStatusSource{
+		Timeout:           1,
+		FastcgiAddress:    "unix:" + socketPath,
+		FastcgiStatusPath: "/fpm-status",
+		FastcgiQuery:      "json&full",
+	})
+	require.Nil(t, err)
+
+	// Act
+	_, err = client.LoadStatus()
+
+	// Assert
+	assert.ErrorIs(t, err, fpmClient.ErrorUnexpectedCode)
+}
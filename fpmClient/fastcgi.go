@@ -0,0 +1,195 @@
+package fpmClient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Минимальный FastCGI клиент, достаточный для одного GET запроса к странице статуса FPM без nginx
+const (
+	fcgiVersion1        = 1
+	fcgiBeginRequest    = 1
+	fcgiEndRequest      = 3
+	fcgiParams          = 4
+	fcgiStdin           = 5
+	fcgiStdout          = 6
+	fcgiStderr          = 7
+	fcgiRoleResponder   = 1
+	fcgiRequestId       = 1
+	fcgiMaxContentBytes = 65535
+)
+
+var ErrorFastcgiStderr = errors.New("fpmClient: fastcgi stderr")
+
+type fcgiHeader struct {
+	Version       uint8
+	Type          uint8
+	RequestId     uint16
+	ContentLength uint16
+	PaddingLength uint8
+	Reserved      uint8
+}
+
+func splitFastcgiAddress(address string) (string, string) {
+	if strings.HasPrefix(address, "unix:") {
+		return "unix", strings.TrimPrefix(address, "unix:")
+	}
+	if strings.HasPrefix(address, "/") {
+		return "unix", address
+	}
+	return "tcp", strings.TrimPrefix(address, "tcp:")
+}
+
+func writeRecord(w io.Writer, recordType uint8, content []byte) error {
+	header := fcgiHeader{
+		Version:       fcgiVersion1,
+		Type:          recordType,
+		RequestId:     fcgiRequestId,
+		ContentLength: uint16(len(content)),
+		PaddingLength: uint8(-len(content) & 7),
+	}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	_, err := w.Write(make([]byte, header.PaddingLength))
+	return err
+}
+
+func encodeParamLength(buf *bytes.Buffer, length int) {
+	if length < 128 {
+		buf.WriteByte(byte(length))
+		return
+	}
+	binary.Write(buf, binary.BigEndian, uint32(length)|1<<31)
+}
+
+func encodeParams(params map[string]string) []byte {
+	var buf bytes.Buffer
+	for name, value := range params {
+		encodeParamLength(&buf, len(name))
+		encodeParamLength(&buf, len(value))
+		buf.WriteString(name)
+		buf.WriteString(value)
+	}
+	return buf.Bytes()
+}
+
+func (c *Client) fastcgiParams() map[string]string {
+	params := map[string]string{
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"SERVER_PROTOCOL":   "HTTP/1.1",
+		"REQUEST_METHOD":    "GET",
+		"SCRIPT_NAME":       c.source.FastcgiStatusPath,
+		"SCRIPT_FILENAME":   c.source.FastcgiStatusPath,
+		"DOCUMENT_URI":      c.source.FastcgiStatusPath,
+		"QUERY_STRING":      c.source.FastcgiQuery,
+		"REQUEST_URI":       c.source.FastcgiStatusPath + "?" + c.source.FastcgiQuery,
+	}
+	for name, value := range c.source.Headers {
+		params["HTTP_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_"))] = value
+	}
+	return params
+}
+
+func (c *Client) loadStatusFastcgi() ([]byte, error) {
+	network, address := splitFastcgiAddress(c.source.FastcgiAddress)
+	conn, err := net.DialTimeout(network, address, c.source.Timeout*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if c.source.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.source.Timeout * time.Second))
+	}
+
+	writer := bufio.NewWriter(conn)
+	beginRequest := []byte{0, fcgiRoleResponder, 0, 0, 0, 0, 0, 0}
+	if err := writeRecord(writer, fcgiBeginRequest, beginRequest); err != nil {
+		return nil, err
+	}
+	params := encodeParams(c.fastcgiParams())
+	for len(params) > 0 {
+		chunkLength := len(params)
+		if chunkLength > fcgiMaxContentBytes {
+			chunkLength = fcgiMaxContentBytes
+		}
+		if err := writeRecord(writer, fcgiParams, params[:chunkLength]); err != nil {
+			return nil, err
+		}
+		params = params[chunkLength:]
+	}
+	if err := writeRecord(writer, fcgiParams, nil); err != nil {
+		return nil, err
+	}
+	if err := writeRecord(writer, fcgiStdin, nil); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := readRecords(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+	if len(stdout) == 0 && len(stderr) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrorFastcgiStderr, stderr)
+	}
+
+	return parseFastcgiResponse(stdout)
+}
+
+func readRecords(reader io.Reader) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	for {
+		var header fcgiHeader
+		if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+			return nil, nil, err
+		}
+		content := make([]byte, int(header.ContentLength)+int(header.PaddingLength))
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, nil, err
+		}
+		content = content[:header.ContentLength]
+		switch header.Type {
+		case fcgiStdout:
+			stdout.Write(content)
+		case fcgiStderr:
+			stderr.Write(content)
+		case fcgiEndRequest:
+			return stdout.Bytes(), stderr.Bytes(), nil
+		}
+	}
+}
+
+func parseFastcgiResponse(stdout []byte) ([]byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(stdout))
+	headers, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if status := headers.Get("Status"); status != "" {
+		statusCode, _ := strconv.Atoi(strings.SplitN(status, " ", 2)[0])
+		if statusCode != 200 {
+			return body, fmt.Errorf("%w: %s", ErrorUnexpectedCode, status)
+		}
+	}
+
+	return body, nil
+}
@@ -1,39 +1,83 @@
 package main
 
 import (
-	"crypto/tls"
 	"encoding/json"
-	"io"
-	"log"
-	"net/http"
+	"fmt"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 	"trace-monitor-collector/config"
+	"trace-monitor-collector/fpmClient"
+	"trace-monitor-collector/logger"
 	"trace-monitor-collector/traceCollection"
 )
 
-func loadFpmStatus(cfg *config.Config) (map[string]interface{}, error) {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+var (
+	fpmStatusMu        sync.RWMutex
+	fpmPoolStatusList  = make(map[string]map[string]interface{})
+	fpmProcessByPidMap = make(map[string]map[string]interface{})
+	fpmLastPollAt      time.Time
+	fpmLastSuccessAt   time.Time
+
+	fpmLog = logger.New("fpm")
+	// Запросы внеплановой проверки из /admin/fpm-check, ответ приходит в переданный канал
+	fpmCheckRequests = make(chan chan fpmCheckResult)
+)
+
+func storeFpmStatus(poolStatusList map[string]map[string]interface{}, fpmStatusPidMap map[string]map[string]interface{}) {
+	now := time.Now()
+	fpmStatusMu.Lock()
+	fpmPoolStatusList = poolStatusList
+	fpmProcessByPidMap = fpmStatusPidMap
+	fpmLastPollAt = now
+	// Успешным считаем опрос, в котором ответил хотя бы один пул
+	if len(poolStatusList) > 0 {
+		fpmLastSuccessAt = now
 	}
+	fpmStatusMu.Unlock()
+}
+
+func getFpmPollTimes() (lastPollAt time.Time, lastSuccessAt time.Time) {
+	fpmStatusMu.RLock()
+	defer fpmStatusMu.RUnlock()
+	return fpmLastPollAt, fpmLastSuccessAt
+}
 
-	client := &http.Client{
-		Timeout:   cfg.HttpClientTimeout * time.Second,
-		Transport: transport,
+func getFpmPoolStatusList() map[string]map[string]interface{} {
+	fpmStatusMu.RLock()
+	defer fpmStatusMu.RUnlock()
+	return fpmPoolStatusList
+}
+
+func getFpmProcess(key string) map[string]interface{} {
+	fpmStatusMu.RLock()
+	defer fpmStatusMu.RUnlock()
+	return fpmProcessByPidMap[key]
+}
+
+func newFpmClientList(cfg *config.Config) ([]*fpmClient.Client, error) {
+	var fpmClientList []*fpmClient.Client
+	for _, source := range cfg.FpmStatusSources {
+		if source.TlsInsecureSkipVerify {
+			fpmLog.Warn("TLS certificate verification is disabled for FPM status source", "pool", source.Name)
+		}
+		client, err := fpmClient.New(source)
+		if err != nil {
+			return nil, fmt.Errorf("FPM status source %q: %w", source.Name, err)
+		}
+		fpmClientList = append(fpmClientList, client)
 	}
+	return fpmClientList, nil
+}
+
+func loadFpmStatus(cfg *config.Config, client *fpmClient.Client) (map[string]interface{}, error) {
 	var fpmStatus map[string]interface{}
-	resp, err := client.Get(cfg.FpmStatusURL)
-	if err != nil {
-		return fpmStatus, err
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	body, err := client.LoadStatus()
 	if err != nil {
 		return fpmStatus, err
 	}
-	if cfg.IsVerboseByLevel("vvv") {
-		log.Println("FPM Status respons body", string(body))
-	}
+	fpmLog.Trace("FPM status response body", "pool", client.Name(), "body", body)
 	jsonErr := json.Unmarshal(body, &fpmStatus)
 	if jsonErr != nil {
 		return fpmStatus, jsonErr
@@ -42,41 +86,119 @@ func loadFpmStatus(cfg *config.Config) (map[string]interface{}, error) {
 	return fpmStatus, nil
 }
 
-func buildPidMap(fpmStatus map[string]interface{}) map[string]map[string]interface{} {
-	var fpmStatusPidMap = make(map[string]map[string]interface{})
-	for _, process := range fpmStatus["processes"].([]interface{}) {
-		pidFloat := process.(map[string]interface{})["pid"].(float64)
+// buildPidMap добавляет процессы источника в fpmStatusPidMap по ключу FpmStatusKey, чтобы pid разных хостов не смешивались.
+// Статус с неожиданной структурой не добавляется целиком
+func buildPidMap(cfg *config.Config, fpmStatusPidMap map[string]map[string]interface{}, source config.FpmStatusSource, fpmStatus map[string]interface{}) error {
+	processes, ok := fpmStatus["processes"].([]interface{})
+	if !ok {
+		return fmt.Errorf("malformed FPM status: no processes list")
+	}
+	sourcePidMap := make(map[string]map[string]interface{}, len(processes))
+	for _, processValue := range processes {
+		process, ok := processValue.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("malformed FPM status: process is not an object")
+		}
+		pidFloat, ok := process["pid"].(float64)
+		if !ok {
+			return fmt.Errorf("malformed FPM status: process pid is not a number")
+		}
 		pid := strconv.FormatFloat(pidFloat, 'f', -1, 64)
-		fpmStatusPidMap[pid] = process.(map[string]interface{})
+		sourcePidMap[traceCollection.FpmStatusKey(cfg, source.App, source.Host, pid)] = process
+	}
+	for key, process := range sourcePidMap {
+		process["pool"] = source.Name
+		fpmStatusPidMap[key] = process
 	}
-	return fpmStatusPidMap
+	return nil
 }
 
-func handleFpmStatus(cfg *config.Config) {
-	defer recoverRoutineHandleFpmStatus(cfg)
-
-	ticker := time.NewTicker(cfg.LoadFpmStatusTimeout * time.Second)
-	defer ticker.Stop()
-	for range ticker.C {
-		fpmStatus, err := loadFpmStatus(cfg)
+func loadFpmStatusPidMap(cfg *config.Config, fpmClientList []*fpmClient.Client) (map[string]map[string]interface{}, map[string]bool) {
+	var fpmStatusPidMap = make(map[string]map[string]interface{})
+	var failedPools = make(map[string]bool)
+	var poolStatusList = make(map[string]map[string]interface{})
+	for _, client := range fpmClientList {
+		fpmStatus, err := loadFpmStatus(cfg, client)
 		if err != nil {
-			if cfg.IsVerboseByLevel("v") {
-				log.Println("load FPM status error.", err)
-			}
+			fpmLog.WarnLimited("load-"+client.Name(), "load FPM status error", "pool", client.Name(), "err", err)
+			failedPools[client.Name()] = true
+			continue
+		}
+		if err := buildPidMap(cfg, fpmStatusPidMap, client.Source(), fpmStatus); err != nil {
+			fpmLog.WarnLimited("load-"+client.Name(), "load FPM status error", "pool", client.Name(), "err", err)
+			failedPools[client.Name()] = true
 			continue
 		}
-		fpmStatusPidMap := buildPidMap(fpmStatus)
+		poolStatusList[client.Name()] = fpmStatus
+	}
+	storeFpmStatus(poolStatusList, fpmStatusPidMap)
+	return fpmStatusPidMap, failedPools
+}
+
+func handleFpmStatus(cfg *config.Config, fpmClientList []*fpmClient.Client) {
+	defer recoverRoutineHandleFpmStatus(cfg, fpmClientList)
 
-		if cfg.IsVerboseByLevel("vvv") {
-			log.Println("Build pid map from fpm status", fpmStatusPidMap)
+	ticker := time.NewTicker(cfg.LoadFpmStatusTimeout * time.Second)
+	defer ticker.Stop()
+	for {
+		var reply chan fpmCheckResult
+		select {
+		case <-ticker.C:
+		case reply = <-fpmCheckRequests:
+		}
+		result := checkFpmStatus(cfg, fpmClientList)
+		if reply != nil {
+			reply <- result
 		}
-		traceCollection.CheckingForHung(cfg, fpmStatusPidMap)
 	}
 }
 
-func recoverRoutineHandleFpmStatus(cfg *config.Config) {
+type fpmCheckResult struct {
+	Pools       int      `json:"pools"`
+	FailedPools []string `json:"failedPools"`
+	Removed     int      `json:"removed"`
+}
+
+func checkFpmStatus(cfg *config.Config, fpmClientList []*fpmClient.Client) fpmCheckResult {
+	fpmStatusPidMap, failedPools := loadFpmStatusPidMap(cfg, fpmClientList)
+	result := fpmCheckResult{Pools: len(fpmClientList), FailedPools: make([]string, 0, len(failedPools))}
+	for pool := range failedPools {
+		result.FailedPools = append(result.FailedPools, pool)
+	}
+	sort.Strings(result.FailedPools)
+	if len(failedPools) == len(fpmClientList) {
+		return result
+	}
+
+	if fpmLog.Enabled(logger.LevelTrace) {
+		fpmLog.Trace("build pid map from FPM status", "pids", fmt.Sprint(fpmStatusPidMap))
+	}
+	result.Removed = traceCollection.CheckingForHung(cfg, fpmStatusPidMap, failedPools)
+	return result
+}
+
+// requestFpmCheck запускает проверку статуса FPM вне расписания и ждёт её результата
+func requestFpmCheck(timeout time.Duration) (fpmCheckResult, bool) {
+	reply := make(chan fpmCheckResult, 1)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case fpmCheckRequests <- reply:
+	case <-timer.C:
+		return fpmCheckResult{}, false
+	}
+	select {
+	case result := <-reply:
+		return result, true
+	case <-timer.C:
+		return fpmCheckResult{}, false
+	}
+}
+
+func recoverRoutineHandleFpmStatus(cfg *config.Config, fpmClientList []*fpmClient.Client) {
 	if r := recover(); r != nil {
-		log.Println("Handle FPM Status error: ", r)
-		go handleFpmStatus(cfg)
+		routinePanics[routineFpm].Increment()
+		fpmLog.Error("handle FPM status panic", "panic", r)
+		go handleFpmStatus(cfg, fpmClientList)
 	}
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/traceCollection"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fpmStatusServer(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+}
+
+func TestLoadFpmStatusPidMapMergesPoolsWithPoolLabel(t *testing.T) {
+	// Arrange
+	wwwServer := fpmStatusServer(`{"pool":"www","processes":[{"pid":101,"state":"Running"},{"pid":102,"state":"Idle"}]}`)
+	defer wwwServer.Close()
+	apiServer := fpmStatusServer(`{"pool":"api","processes":[{"pid":201,"state":"Running"}]}`)
+	defer apiServer.Close()
+	cfg := &config.Config{
+		FpmStatusSources: []config.FpmStatusSource{
+			{Name: "www", URL: wwwServer.URL, Timeout: 1},
+			{Name: "api", URL: apiServer.URL, Timeout: 1},
+			{Name: "down", URL: "http://127.0.0.1:1/status", Timeout: 1},
+		},
+	}
+
+	fpmClientList, err := newFpmClientList(cfg)
+	require.Nil(t, err)
+
+	// Act
+	pidMap, failedPools := loadFpmStatusPidMap(cfg, fpmClientList)
+
+	// Assert
+	assert.Len(t, pidMap, 3)
+	assert.Equal(t, "www", pidMap["101"]["pool"])
+	assert.Equal(t, "www", pidMap["102"]["pool"])
+	assert.Equal(t, "api", pidMap["201"]["pool"])
+	assert.Equal(t, map[string]bool{"down": true}, failedPools)
+}
+
+func TestLoadFpmStatusPidMapKeysRemoteSourceByHostAndSkipsMalformedSource(t *testing.T) {
+	// Arrange
+	localServer := fpmStatusServer(`{"pool":"www","processes":[{"pid":101,"state":"Running"}]}`)
+	defer localServer.Close()
+	remoteServer := fpmStatusServer(`{"pool":"www","processes":[{"pid":101,"state":"Idle"}]}`)
+	defer remoteServer.Close()
+	malformedServer := fpmStatusServer(`{"pool":"api","processes":[{"pid":"301"}]}`)
+	defer malformedServer.Close()
+	cfg := &config.Config{
+		AppName: "app-name",
+		FpmStatusSources: []config.FpmStatusSource{
+			{Name: "www", URL: localServer.URL, Timeout: 1},
+			{Name: "remote", App: "app-name", Host: "web-2", URL: remoteServer.URL, Timeout: 1},
+			{Name: "api", URL: malformedServer.URL, Timeout: 1},
+		},
+	}
+	fpmClientList, err := newFpmClientList(cfg)
+	require.Nil(t, err)
+
+	// Act
+	pidMap, failedPools := loadFpmStatusPidMap(cfg, fpmClientList)
+
+	// Assert
+	assert.Len(t, pidMap, 2)
+	assert.Equal(t, "Running", pidMap["101"]["state"])
+	assert.Equal(t, "Idle", pidMap[traceCollection.ProcessKey("", "web-2", "101")]["state"])
+	assert.Equal(t, map[string]bool{"api": true}, failedPools)
+}
+
+func TestExporterAggregatesFpmProcessesByStateAndNormalizedUri(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{AppName: "app-name", FpmUriMetricsMaxKeys: 10}
+	previousPoolStatusList, previousPidMap := getFpmPoolStatusList(), fpmProcessByPidMap
+	defer storeFpmStatus(previousPoolStatusList, previousPidMap)
+	storeFpmStatus(map[string]map[string]interface{}{
+		"www": {"pool": "www", "processes": []interface{}{
+			map[string]interface{}{"pid": float64(101), "state": "Running", "requests": float64(3), "request method": "GET", "request uri": "/user/12/orders?page=1"},
+			map[string]interface{}{"pid": float64(102), "state": "Running", "requests": float64(5), "request method": "GET", "request uri": "/user/34/orders"},
+			map[string]interface{}{"pid": float64(103), "state": "Idle", "requests": float64(7)},
+		}},
+	}, nil)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewExporter(cfg))
+
+	// Act
+	families, err := registry.Gather()
+
+	// Assert
+	require.Nil(t, err)
+	requestsByState := make(map[string]float64)
+	processesByUri := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := labelsOf(metric)
+			assert.NotContains(t, labels, "pid", family.GetName())
+			switch family.GetName() {
+			case "trace_monitor_fpm_process_requests":
+				requestsByState[labels["state"]] = metric.GetGauge().GetValue()
+			case "trace_monitor_fpm_processes":
+				processesByUri[labels["state"]+" "+labels["request_uri"]] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{"Running": 8, "Idle": 7}, requestsByState)
+	assert.Equal(t, map[string]float64{"Running /user/{id}/orders": 2, "Idle ": 1}, processesByUri)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+)
+
+// Имена фоновых горутин, которые перезапускаются после паники
+const (
+	routineUdp         = "udp"
+	routineFpm         = "fpm"
+	routineHttp        = "http"
+	routineMetricsHttp = "metrics_http"
+	routinePidLiveness = "pid_liveness"
+	routineMetricsPush = "metrics_push"
+)
+
+// Статус FPM считается устаревшим, если успешного опроса не было дольше этого числа интервалов опроса
+const fpmStaleIntervals = 3
+
+var (
+	startedAt         = time.Now()
+	udpListenersBound counter.CounterStruct
+	udpReadersAlive   counter.CounterStruct
+	routinePanics     = map[string]*counter.CounterStruct{
+		routineUdp:         {},
+		routineFpm:         {},
+		routineHttp:        {},
+		routineMetricsHttp: {},
+		routinePidLiveness: {},
+		routineMetricsPush: {},
+	}
+)
+
+type udpHealth struct {
+	Listeners uint64 `json:"listeners"`
+	Readers   uint64 `json:"readers"`
+	Expected  int    `json:"expected"`
+}
+
+type fpmHealth struct {
+	Sources       int        `json:"sources"`
+	LastPollAt    *time.Time `json:"lastPollAt"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt"`
+	IsStale       bool       `json:"isStale"`
+}
+
+type healthReport struct {
+	Status        string            `json:"status"`
+	UptimeSeconds float64           `json:"uptimeSeconds"`
+	Udp           udpHealth         `json:"udp"`
+	Fpm           fpmHealth         `json:"fpm"`
+	Panics        map[string]uint64 `json:"panics"`
+	Problems      []string          `json:"problems"`
+}
+
+func countRoutinePanics() map[string]uint64 {
+	panics := make(map[string]uint64, len(routinePanics))
+	for routine, total := range routinePanics {
+		panics[routine] = total.Count()
+	}
+	return panics
+}
+
+// buildHealthReport собирает состояние коллектора.
+// isAlive ложно, только если остановились читатели UDP каналов: без перезапуска процесса пакеты не обработаются.
+// isReady дополнительно требует, чтобы все UDP порты были открыты, а статус FPM не устарел.
+func buildHealthReport(cfg *config.Config, now time.Time) (report healthReport, isAlive bool, isReady bool) {
+	report = healthReport{
+		UptimeSeconds: now.Sub(startedAt).Seconds(),
+		Udp: udpHealth{
+			Listeners: udpListenersBound.Count(),
+			Readers:   udpReadersAlive.Count(),
+			Expected:  cfg.UdpPortRangeCount,
+		},
+		Fpm:      fpmHealth{Sources: len(cfg.FpmStatusSources)},
+		Panics:   countRoutinePanics(),
+		Problems: []string{},
+	}
+
+	lastPollAt, lastSuccessAt := getFpmPollTimes()
+	if !lastPollAt.IsZero() {
+		report.Fpm.LastPollAt = &lastPollAt
+	}
+	if !lastSuccessAt.IsZero() {
+		report.Fpm.LastSuccessAt = &lastSuccessAt
+	}
+	if report.Fpm.Sources > 0 && cfg.LoadFpmStatusTimeout > 0 {
+		// До первого опроса отсчитываем от запуска, чтобы коллектор не был неготов сразу после старта
+		since := startedAt
+		if lastSuccessAt.After(since) {
+			since = lastSuccessAt
+		}
+		report.Fpm.IsStale = now.Sub(since) > fpmStaleIntervals*cfg.LoadFpmStatusTimeout*time.Second
+	}
+
+	isAlive = true
+	if report.Udp.Listeners > 0 && report.Udp.Readers < uint64(report.Udp.Expected) {
+		isAlive = false
+		report.Problems = append(report.Problems, "udp readers stopped")
+	}
+	isReady = isAlive
+	if report.Udp.Listeners < uint64(report.Udp.Expected) {
+		isReady = false
+		report.Problems = append(report.Problems, "udp listeners not bound")
+	}
+	if report.Fpm.IsStale {
+		isReady = false
+		report.Problems = append(report.Problems, "fpm status is stale")
+	}
+	sort.Strings(report.Problems)
+
+	report.Status = "ok"
+	if !isReady {
+		report.Status = "fail"
+	}
+	return report, isAlive, isReady
+}
+
+func serveHealth(w http.ResponseWriter, cfg *config.Config, isReadiness bool) {
+	report, isAlive, isReady := buildHealthReport(cfg, time.Now())
+	statusCode := http.StatusOK
+	if (isReadiness && !isReady) || (!isReadiness && !isAlive) {
+		statusCode = http.StatusServiceUnavailable
+	}
+	if !isReadiness && isAlive {
+		report.Status = "ok"
+	}
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		httpLog.Error("encoding JSON", "err", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jsonBytes)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"trace-monitor-collector/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadyzFailsWhileUdpListenersAreNotBound(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{UdpPortRangeCount: 1}
+	healthRecorder := httptest.NewRecorder()
+	readyRecorder := httptest.NewRecorder()
+
+	// Act
+	routeHTTP(healthRecorder, httptest.NewRequest(http.MethodGet, "/healthz", nil), cfg)
+	routeHTTP(readyRecorder, httptest.NewRequest(http.MethodGet, "/readyz", nil), cfg)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, healthRecorder.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, readyRecorder.Code)
+	var report healthReport
+	require.Nil(t, json.Unmarshal(readyRecorder.Body.Bytes(), &report))
+	assert.Equal(t, "fail", report.Status)
+	assert.Equal(t, []string{"udp listeners not bound"}, report.Problems)
+	assert.Contains(t, report.Panics, routineUdp)
+}
+
+func TestHealthReportMarksFpmStatusStale(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{
+		FpmStatusSources:     []config.FpmStatusSource{{Name: "www"}},
+		LoadFpmStatusTimeout: 100,
+	}
+
+	// Act
+	freshReport, _, isFreshReady := buildHealthReport(cfg, startedAt.Add(time.Minute))
+	staleReport, isAlive, isStaleReady := buildHealthReport(cfg, startedAt.Add(10*time.Minute))
+
+	// Assert
+	assert.False(t, freshReport.Fpm.IsStale)
+	assert.True(t, isFreshReady)
+	assert.True(t, staleReport.Fpm.IsStale)
+	assert.True(t, isAlive)
+	assert.False(t, isStaleReady)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"trace-monitor-collector/config"
+)
+
+type accessControl struct {
+	access     config.HttpAccess
+	allowedIps []*net.IPNet
+	next       http.Handler
+}
+
+func parseAllowIps(allowIps []string) ([]*net.IPNet, error) {
+	var ipNetList []*net.IPNet
+	for _, allowIp := range allowIps {
+		if !strings.Contains(allowIp, "/") {
+			if ip := net.ParseIP(allowIp); ip != nil && ip.To4() != nil {
+				allowIp += "/32"
+			} else {
+				allowIp += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(allowIp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow_ips entry %q: %w", allowIp, err)
+		}
+		ipNetList = append(ipNetList, ipNet)
+	}
+	return ipNetList, nil
+}
+
+func withAccessControl(access config.HttpAccess, next http.Handler) (http.Handler, error) {
+	allowedIps, err := parseAllowIps(access.AllowIps)
+	if err != nil {
+		return nil, err
+	}
+	return &accessControl{access: access, allowedIps: allowedIps, next: next}, nil
+}
+
+func (a *accessControl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.isIpAllowed(r.RemoteAddr) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !a.isAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="trace-monitor-collector"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	a.next.ServeHTTP(w, r)
+}
+
+func (a *accessControl) isIpAllowed(remoteAddr string) bool {
+	if len(a.allowedIps) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range a.allowedIps {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *accessControl) isAuthorized(r *http.Request) bool {
+	if len(a.access.BearerTokens) == 0 && len(a.access.BasicUsers) == 0 {
+		return true
+	}
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		for _, allowedToken := range a.access.BearerTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(allowedToken)) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	allowedPassword, isExist := a.access.BasicUsers[user]
+	return isExist && subtle.ConstantTimeCompare([]byte(password), []byte(allowedPassword)) == 1
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"trace-monitor-collector/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveWithAccess(t *testing.T, access config.HttpAccess, r *http.Request) int {
+	handler, err := withAccessControl(access, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	require.Nil(t, err)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	return recorder.Code
+}
+
+func TestAccessControlAllowsEverythingWhenNotConfigured(t *testing.T) {
+	// Arrange
+	r := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+
+	// Act
+	code := serveWithAccess(t, config.HttpAccess{}, r)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestAccessControlChecksBearerTokenAndBasicAuth(t *testing.T) {
+	// Arrange
+	access := config.HttpAccess{
+		BearerTokens: []string{"secret-token"},
+		BasicUsers:   map[string]string{"admin": "password"},
+	}
+	anonymous := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+	withToken := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+	withToken.Header.Set("Authorization", "Bearer secret-token")
+	withWrongToken := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+	withWrongToken.Header.Set("Authorization", "Bearer wrong")
+	withBasic := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+	withBasic.SetBasicAuth("admin", "password")
+	withWrongBasic := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+	withWrongBasic.SetBasicAuth("admin", "wrong")
+
+	// Act & Assert
+	assert.Equal(t, http.StatusUnauthorized, serveWithAccess(t, access, anonymous))
+	assert.Equal(t, http.StatusOK, serveWithAccess(t, access, withToken))
+	assert.Equal(t, http.StatusUnauthorized, serveWithAccess(t, access, withWrongToken))
+	assert.Equal(t, http.StatusOK, serveWithAccess(t, access, withBasic))
+	assert.Equal(t, http.StatusUnauthorized, serveWithAccess(t, access, withWrongBasic))
+}
+
+func TestAccessControlChecksAllowIps(t *testing.T) {
+	// Arrange
+	access := config.HttpAccess{AllowIps: []string{"127.0.0.1", "10.0.0.0/8"}}
+	fromLocalhost := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+	fromLocalhost.RemoteAddr = "127.0.0.1:54321"
+	fromNetwork := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+	fromNetwork.RemoteAddr = "10.1.2.3:54321"
+	fromOutside := httptest.NewRequest(http.MethodGet, "/getall.json", nil)
+	fromOutside.RemoteAddr = "192.168.1.1:54321"
+
+	// Act & Assert
+	assert.Equal(t, http.StatusOK, serveWithAccess(t, access, fromLocalhost))
+	assert.Equal(t, http.StatusOK, serveWithAccess(t, access, fromNetwork))
+	assert.Equal(t, http.StatusForbidden, serveWithAccess(t, access, fromOutside))
+}
+
+func TestAccessControlReturnsErrorWhenAllowIpsIsInvalid(t *testing.T) {
+	// Act
+	_, err := withAccessControl(config.HttpAccess{AllowIps: []string{"not-an-ip/99"}}, http.NotFoundHandler())
+
+	// Assert
+	assert.NotNil(t, err)
+}
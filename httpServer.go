@@ -4,26 +4,54 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
-	"html/template"
-	"log"
+	"io/fs"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 	"trace-monitor-collector/config"
+	"trace-monitor-collector/failures"
+	"trace-monitor-collector/logger"
+	"trace-monitor-collector/redaction"
+	"trace-monitor-collector/reorder"
+	"trace-monitor-collector/skew"
+	"trace-monitor-collector/stats"
+	"trace-monitor-collector/stream"
+	"trace-monitor-collector/tagFilter"
 	"trace-monitor-collector/traceCollection"
-
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-//go:embed json-viewer.tmpl
-var tmpl embed.FS
+//go:embed web
+var webFS embed.FS
+
+var httpLog = logger.New("http")
+
+var webStaticHandler = http.StripPrefix("/static/", http.FileServer(http.FS(mustSubFS(webFS, "web"))))
+
+func mustSubFS(fsys fs.FS, dir string) fs.FS {
+	subFS, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return subFS
+}
 
 type dataStruct struct {
-	Trace   []byte
-	Span    []byte
-	Context []byte
-	Tags    []byte
-	TraceId string
-	SentAt  time.Time
+	Trace      []byte
+	Span       []byte
+	Context    []byte
+	Tags       []byte
+	App        string
+	Host       string
+	Pid        string
+	TraceId    string
+	SentAt     time.Time
+	ReceivedAt time.Time
+	Events     [][]byte
+	Errors     []traceCollection.TraceError
+
+	LostPackets uint64
 }
 
 func handleHttp(cfg *config.Config) {
@@ -32,53 +60,325 @@ func handleHttp(cfg *config.Config) {
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		routeHTTP(w, r, cfg)
 	})
-	http.Handle("/console/metrics", promhttp.Handler())
-	if cfg.IsVerboseByLevel("v") {
-		log.Println("HTTP server started on", cfg.HttpAddr)
+	// Обработчик метрик собирается один раз: InstrumentMetricHandler регистрирует свои счётчики
+	if cfg.MetricsAddr == "" {
+		http.Handle("/console/metrics", metricsHandler(cfg))
+	}
+	handler, err := withAccessControl(cfg.HttpAccess, http.DefaultServeMux)
+	if err != nil {
+		httpLog.Error("invalid http_access", "err", err)
+		os.Exit(1)
+	}
+	// /admin/ проверяется только admin_access, а не http_access: у них разные учётные данные
+	if adminHandler != nil {
+		rootMux := http.NewServeMux()
+		rootMux.Handle("/", handler)
+		rootMux.Handle("/admin/", adminHandler)
+		handler = rootMux
+	} else {
+		httpLog.Info("admin endpoints disabled, admin_access has no credentials")
+	}
+	httpLog.Info("HTTP server started", "addr", cfg.HttpAddr)
+	if err := listenAndServe(cfg, cfg.HttpAddr, handler); err != nil {
+		httpLog.Error("HTTP server error", "addr", cfg.HttpAddr, "err", err)
+	}
+}
+
+func handleMetricsHttp(cfg *config.Config) {
+	defer recoverRoutineHandleMetricsHttp(cfg)
+
+	mux := http.NewServeMux()
+	metrics := metricsHandler(cfg)
+	mux.Handle("/console/metrics", metrics)
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		serveHealth(w, cfg, false)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		serveHealth(w, cfg, true)
+	})
+	handler, err := withAccessControl(cfg.MetricsAccess, mux)
+	if err != nil {
+		httpLog.Error("invalid metrics_access", "err", err)
+		os.Exit(1)
+	}
+	httpLog.Info("Metrics HTTP server started", "addr", cfg.MetricsAddr)
+	if err := listenAndServe(cfg, cfg.MetricsAddr, handler); err != nil {
+		httpLog.Error("Metrics HTTP server error", "addr", cfg.MetricsAddr, "err", err)
+	}
+}
+
+func listenAndServe(cfg *config.Config, addr string, handler http.Handler) error {
+	if cfg.HttpTlsCertFile != "" || cfg.HttpTlsKeyFile != "" {
+		return http.ListenAndServeTLS(addr, cfg.HttpTlsCertFile, cfg.HttpTlsKeyFile, handler)
+	}
+	return http.ListenAndServe(addr, handler)
+}
+
+func recoverRoutineHandleMetricsHttp(cfg *config.Config) {
+	if r := recover(); r != nil {
+		routinePanics[routineMetricsHttp].Increment()
+		httpLog.Error("handle metrics HTTP server panic", "panic", r)
+		go handleMetricsHttp(cfg)
 	}
-	http.ListenAndServe(cfg.HttpAddr, nil)
 }
 
 func recoverRoutineHandleHttp(cfg *config.Config) {
 	if r := recover(); r != nil {
-		log.Println("Handle HTTP server error: ", r)
+		routinePanics[routineHttp].Increment()
+		httpLog.Error("handle HTTP server panic", "panic", r)
 		go handleHttp(cfg)
 	}
 }
 
 func routeHTTP(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
-	if r.URL.Path == "/console/metrics" {
-		promhttp.Handler().ServeHTTP(w, r)
-	} else if r.URL.Path == "/getall.json" {
-		jsonBytes, err := buildJsonBytesAll(cfg)
+	if r.URL.Path == "/getall.json" {
+		jsonBytes, err := buildJsonBytesAll(cfg, r.URL.Query().Get("app"))
 		if err != nil {
-			log.Printf("Error encoding JSON: %v", err)
+			httpLog.Error("encoding JSON", "err", err)
 		}
+		w.Header().Set("Content-Type", "application/json")
 		w.Write(jsonBytes)
 	} else if r.URL.Path == "/getall" {
-		jsonBytes, err := buildJsonBytesAll(cfg)
+		indexBytes, err := webFS.ReadFile("web/index.html")
 		if err != nil {
-			log.Printf("Error encoding JSON: %v", err)
+			httpLog.Error("read web UI", "err", err)
 		}
-		t, err := template.ParseFS(tmpl, "json-viewer.tmpl")
-		if err != nil {
-			log.Fatal(err)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexBytes)
+	} else if r.URL.Path == "/stats/top" {
+		serveStatsTop(w, r)
+	} else if strings.HasPrefix(r.URL.Path, "/trace/by-id/") {
+		serveTraceById(w, strings.TrimPrefix(r.URL.Path, "/trace/by-id/"), cfg)
+	} else if r.URL.Path == "/healthz" {
+		serveHealth(w, cfg, false)
+	} else if r.URL.Path == "/readyz" {
+		serveHealth(w, cfg, true)
+	} else if r.URL.Path == "/errors" {
+		serveFailedTraces(w, r, cfg)
+	} else if r.URL.Path == "/stream" {
+		serveStream(w, r, cfg)
+	} else if strings.HasPrefix(r.URL.Path, "/static/") {
+		webStaticHandler.ServeHTTP(w, r)
+	} else {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+	}
+}
+
+func serveStatsTop(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	window := stats.DefaultWindow
+	if query.Get("window") != "" {
+		var err error
+		window, err = time.ParseDuration(query.Get("window"))
+		if err != nil || window <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
 		}
-		err = t.Execute(w, string(jsonBytes))
-		if err != nil {
-			log.Printf("Error execute json to template: %v", err)
+	}
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = stats.SortByP95
+	}
+	if !stats.IsValidSortBy(sortBy) {
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
+	limit := stats.DefaultTopLimit
+	if query.Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
 		}
-	} else {
+	}
+
+	now := time.Now()
+	result := map[string]interface{}{
+		"window": window.String(),
+		"sort":   sortBy,
+	}
+	switch query.Get("by") {
+	case "span":
+		result["span"] = stats.Spans.Top(window, sortBy, limit, now)
+	case "uri":
+		result["uri"] = stats.Uris.Top(window, sortBy, limit, now)
+	case "query":
+		result["query"] = stats.Queries.Top(window, sortBy, limit, now)
+	case "":
+		result["span"] = stats.Spans.Top(window, sortBy, limit, now)
+		result["uri"] = stats.Uris.Top(window, sortBy, limit, now)
+		result["query"] = stats.Queries.Top(window, sortBy, limit, now)
+	default:
+		http.Error(w, "Invalid by", http.StatusBadRequest)
+		return
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		httpLog.Error("encoding JSON", "err", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+func serveStream(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	filter := stream.Filter{
+		App:      query.Get("app"),
+		Pid:      query.Get("pid"),
+		TraceId:  query.Get("traceId"),
+		SpanName: query.Get("span"),
+	}
+	filter.TagKey, filter.TagValue = tagFilter.Parse(query.Get("tag"))
+
+	subscriber := stream.Subscribe(filter, cfg.StreamBuffer)
+	defer stream.Unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	var lastDropped uint64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event := <-subscriber.Events():
+			if dropped := subscriber.Dropped(); dropped != lastDropped {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped-lastDropped)
+				lastDropped = dropped
+			}
+			eventBytes, err := json.Marshal(event)
+			if err != nil {
+				httpLog.Error("encoding stream event", "err", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, eventBytes)
+		}
+		flusher.Flush()
+	}
+}
+
+func redactRawData(data json.RawMessage, path ...string) json.RawMessage {
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+	redacted, err := json.Marshal(traceCollection.Redactor.Redact(decoded, path...))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+// serveTraceById ищет трейс сначала среди активных, затем среди сохранённых завершённых
+func serveTraceById(w http.ResponseWriter, traceId string, cfg *config.Config) {
+	var response map[string]interface{}
+	if traceId == "" {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if valueByte := traceCollection.FindByTraceId(traceId); valueByte != nil {
+		var valueData = dataStruct{}
+		json.Unmarshal(valueByte, &valueData)
+		response = map[string]interface{}{"status": "active", "trace": buildPidInfo(cfg, valueData)}
+	} else if retainedTraceStore != nil {
+		if trace, isExist := retainedTraceStore.Get(traceId); isExist {
+			if cfg.Redaction.OnOutput {
+				trace.Tags = redactRawData(trace.Tags, "tags")
+				trace.Context = redactRawData(trace.Context, "context")
+				trace.Trace = redactRawData(trace.Trace)
+				events := make([]json.RawMessage, 0, len(trace.Events))
+				for _, event := range trace.Events {
+					events = append(events, redactEventOnOutput(event))
+				}
+				trace.Events = events
+			}
+			response = map[string]interface{}{"status": "retained", "trace": trace}
+		}
 	}
+	if response == nil {
+		http.Error(w, "Trace not found", http.StatusNotFound)
+		return
+	}
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		httpLog.Error("encoding JSON", "err", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
 }
 
-func buildJsonBytesAll(cfg *config.Config) ([]byte, error) {
+func redactEventOnOutput(eventBytes json.RawMessage) json.RawMessage {
+	var event map[string]interface{}
+	if err := json.Unmarshal(eventBytes, &event); err != nil {
+		return eventBytes
+	}
+	if eventData, ok := event["data"].(map[string]interface{}); ok {
+		traceCollection.Redactor.Redact(eventData)
+	}
+	redacted, _ := json.Marshal(event)
+	return redacted
+}
+
+func serveFailedTraces(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	query := r.URL.Query()
+	appFilter := query.Get("app")
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = cfg.FailedTracesKeep
+	}
+	jsonBytes, err := json.Marshal(map[string]interface{}{
+		"traces":  listFailedTraces(cfg, failedTraceStore, appFilter, limit),
+		"dropped": listFailedTraces(cfg, droppedTraceStore, appFilter, limit),
+	})
+	if err != nil {
+		httpLog.Error("encoding JSON", "err", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
+
+func listFailedTraces(cfg *config.Config, store *failures.Store, appFilter string, limit int) []failures.Trace {
+	traces := make([]failures.Trace, 0)
+	if store == nil {
+		return traces
+	}
+	for _, trace := range store.List() {
+		if appFilter != "" && appFilter != appNameOf(cfg, trace.App) {
+			continue
+		}
+		if len(traces) >= limit {
+			break
+		}
+		if cfg.Redaction.OnOutput {
+			trace.Tags = redactRawData(trace.Tags, "tags")
+			trace.Context = redactRawData(trace.Context, "context")
+		}
+		traces = append(traces, trace)
+	}
+	return traces
+}
+
+func buildJsonBytesAll(cfg *config.Config, appFilter string) ([]byte, error) {
 	jsonData := map[string]map[string]map[string]interface{}{
 		"stats": {
 			"_": {
-				"serverTime": time.Now().String(),
-				"appVersion": AppVersion,
+				"serverTime":           time.Now().String(),
+				"appVersion":           AppVersion,
+				"stuckProcessDuration": int64(cfg.StuckProcessDuration),
 			},
 			"totalCounts": {
 				"traceSet":          traceCollection.TotalTraceSet.Count(),
@@ -88,68 +388,176 @@ func buildJsonBytesAll(cfg *config.Config) ([]byte, error) {
 				"packagesCaught":    totalPackagesCaught.Count(),
 				"packagesParse":     totalPackagesParse.Count(),
 				"totalChannelReset": totalChannelReset.Count(),
+				"pidReuse":          traceCollection.TotalPidReuse.Count(),
+				"pidDead":           traceCollection.TotalPidDead.Count(),
+				"redactedByKey":     redaction.TotalRedactedByKey.Count(),
+				"redactedByPath":    redaction.TotalRedactedByPath.Count(),
+				"redactedByPattern": redaction.TotalRedactedByPattern.Count(),
+				"reordered":         reorder.TotalReordered.Count(),
+				"duplicate":         reorder.TotalDuplicate.Count(),
+				"late":              reorder.TotalLate.Count(),
+				"seqPackets":        traceCollection.TotalSeqPackets.Count(),
+				"lostPackets":       traceCollection.TotalLostPackets.Count(),
+				"clockSkewWarnings": skew.TotalSkewWarnings.Count(),
+				"traceErrors":       traceCollection.TotalTraceErrors.Count(),
+				"failedTraces":      failures.TotalFailedTraces.Count(),
+				"evictedByEntries":  traceCollection.TotalEvictedByEntries.Count(),
+				"evictedByBytes":    traceCollection.TotalEvictedByBytes.Count(),
+				"evictedByAdmin":    traceCollection.TotalEvictedByAdmin.Count(),
+				"truncatedFields":   traceCollection.TotalTruncatedFields.Count(),
+				"logSuppressed":     logger.TotalSuppressedWarnings.Count(),
+				"routinePanics":     countRoutinePanics(),
+				"packetPanics":      totalPacketPanics.Count(),
+				"metricsPush":       countMetricsPush(),
 			},
 			"gauge": {
-				"countActivePid": traceCollection.CountActivePid.Count(),
+				"countActivePid":        traceCollection.CountActivePid.Count(),
+				"countIncompleteTraces": traceCollection.CountIncompleteTraces(),
+				"storeBytes":            traceCollection.BytesHeld(),
 			},
 		},
-		"trace": {},
+		"trace":     {},
+		"fpm":       {},
+		"clockSkew": {},
 	}
-	dataCollection := traceCollection.GetAllTrace()
-	for pid, valueByte := range dataCollection {
-		var valueData = dataStruct{}
-		json.Unmarshal(valueByte, &valueData)
-		duration := time.Since(valueData.SentAt)
-		var trace map[string]interface{}
-		json.Unmarshal(valueData.Trace, &trace)
-		var trace_context map[string]interface{}
-		var trace_tags map[string]interface{}
-		if trace != nil {
-			trace = unpackData(trace)
-			trace_context, _ = trace["context"].(map[string]interface{})
-			trace_tags, _ = trace["tags"].(map[string]interface{})
-			delete(trace, "context")
-			delete(trace, "tags")
+	if retainedTraceStore != nil {
+		kept, dropped := retentionPolicy.CountByRule()
+		jsonData["stats"]["retention"] = map[string]interface{}{
+			"kept":     kept,
+			"dropped":  dropped,
+			"retained": retainedTraceStore.Len(),
 		}
-		var span map[string]interface{}
-		json.Unmarshal(valueData.Span, &span)
-		if span != nil {
-			span = unpackData(span)
-		}
-		var context map[string]interface{}
-		json.Unmarshal(valueData.Context, &context)
-
-		if context == nil {
-			context = trace_context
-		} else {
-			context = unpackData(context)
+	}
+	jsonData["stats"]["commands"] = map[string]interface{}{
+		unknownCommandMethod: totalUnknownCommand.Count(),
+	}
+	for method, count := range countCommandsByMethod() {
+		jsonData["stats"]["commands"][method] = count
+	}
+	if clockSkew != nil {
+		for _, sourceSkew := range clockSkew.Snapshot(time.Now()) {
+			jsonData["clockSkew"][sourceSkew.Source] = map[string]interface{}{
+				"skewMs":     sourceSkew.Offset.Milliseconds(),
+				"isExceeded": sourceSkew.IsExceeded,
+			}
 		}
-		var tags map[string]interface{}
-		json.Unmarshal(valueData.Tags, &tags)
-		if tags == nil {
-			tags = trace_tags
-		} else {
-			tags = unpackData(tags)
+	}
+	for pool, fpmStatus := range getFpmPoolStatusList() {
+		poolInfo := make(map[string]interface{}, len(fpmStatus))
+		for key, value := range fpmStatus {
+			if key != "processes" {
+				poolInfo[key] = value
+			}
 		}
-		pidInfo := map[string]interface{}{
-			"sentAt":      valueData.SentAt,
-			"pid":         pid,
-			"traceId":     valueData.TraceId,
-			"elapsedTime": duration.String(),
-			"trace":       trace,
-			"span":        span,
-			"context":     context,
-			"tags":        tags,
+		jsonData["fpm"][pool] = poolInfo
+	}
+	dataCollection := traceCollection.GetAllTrace()
+	for key, valueByte := range dataCollection {
+		var valueData = dataStruct{}
+		json.Unmarshal(valueByte, &valueData)
+		app := appNameOf(cfg, valueData.App)
+		if appFilter != "" && appFilter != app {
+			continue
 		}
-		jsonData["trace"][pid] = pidInfo
+		jsonData["trace"][key] = buildPidInfo(cfg, valueData)
 	}
 	jsonBytes, err := json.Marshal(jsonData)
 	if err != nil {
-		return []byte{}, fmt.Errorf("skip delete trace command. %v", err)
+		return []byte{}, fmt.Errorf("encoding active traces. %v", err)
 	}
 	return jsonBytes, nil
 }
 
+func buildPidInfo(cfg *config.Config, valueData dataStruct) map[string]interface{} {
+	app := appNameOf(cfg, valueData.App)
+	duration := time.Since(traceCollection.LastSeenAt(cfg, valueData.SentAt, valueData.ReceivedAt))
+	var trace map[string]interface{}
+	json.Unmarshal(valueData.Trace, &trace)
+	var trace_context map[string]interface{}
+	var trace_tags map[string]interface{}
+	if trace != nil {
+		trace = unpackData(trace)
+		redactOnOutput(cfg, trace)
+		trace_context, _ = trace["context"].(map[string]interface{})
+		trace_tags, _ = trace["tags"].(map[string]interface{})
+		delete(trace, "context")
+		delete(trace, "tags")
+	}
+	var span map[string]interface{}
+	json.Unmarshal(valueData.Span, &span)
+	if span != nil {
+		span = unpackData(span)
+		redactOnOutput(cfg, span)
+	}
+	var context map[string]interface{}
+	json.Unmarshal(valueData.Context, &context)
+
+	if context == nil {
+		context = trace_context
+	} else {
+		context = unpackData(context)
+		redactOnOutput(cfg, context, "context")
+	}
+	var tags map[string]interface{}
+	json.Unmarshal(valueData.Tags, &tags)
+	if tags == nil {
+		tags = trace_tags
+	} else {
+		tags = unpackData(tags)
+		redactOnOutput(cfg, tags, "tags")
+	}
+	pidInfo := map[string]interface{}{
+		"sentAt":               valueData.SentAt,
+		"receivedAt":           valueData.ReceivedAt,
+		"app":                  app,
+		"host":                 valueData.Host,
+		"pid":                  valueData.Pid,
+		"traceId":              valueData.TraceId,
+		"pool":                 "",
+		"stuckProcessDuration": cfg.StuckProcessDurationByApp(valueData.App).Seconds(),
+		"elapsedTime":          duration.String(),
+		"elapsedMs":            duration.Milliseconds(),
+		"trace":                trace,
+		"span":                 span,
+		"context":              context,
+		"tags":                 tags,
+		"lostPackets":          valueData.LostPackets,
+	}
+	if len(valueData.Events) > 0 {
+		events := make([]map[string]interface{}, 0, len(valueData.Events))
+		for _, eventBytes := range valueData.Events {
+			var event map[string]interface{}
+			json.Unmarshal(eventBytes, &event)
+			if eventData, ok := event["data"].(map[string]interface{}); ok {
+				redactOnOutput(cfg, eventData)
+			}
+			events = append(events, event)
+		}
+		pidInfo["events"] = events
+	}
+	if len(valueData.Errors) > 0 {
+		pidInfo["errors"] = valueData.Errors
+	}
+	if valueData.LostPackets > 0 {
+		pidInfo["warning"] = "trace may be incomplete"
+	}
+	// Пул берётся из статуса FPM при чтении, в самом трейсе его нет
+	if traceCollection.HasFpmStatusSource(cfg, valueData.App, valueData.Host) {
+		fpmProcess := getFpmProcess(traceCollection.FpmStatusKey(cfg, valueData.App, valueData.Host, valueData.Pid))
+		pidInfo["fpm"] = fpmProcess
+		if pool, ok := fpmProcess["pool"].(string); ok {
+			pidInfo["pool"] = pool
+		}
+	}
+	return pidInfo
+}
+
+func redactOnOutput(cfg *config.Config, data map[string]interface{}, path ...string) {
+	if cfg.Redaction.OnOutput {
+		traceCollection.Redactor.Redact(data, path...)
+	}
+}
+
 func unpackData(data map[string]interface{}) map[string]interface{} {
 	if _, ok := data["data"]; ok {
 		return data["data"].(map[string]interface{})
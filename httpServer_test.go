@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"trace-monitor-collector/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebDashboardIsServedFromEmbeddedFiles(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{}
+	indexRecorder := httptest.NewRecorder()
+	scriptRecorder := httptest.NewRecorder()
+
+	// Act
+	routeHTTP(indexRecorder, httptest.NewRequest(http.MethodGet, "/getall", nil), cfg)
+	routeHTTP(scriptRecorder, httptest.NewRequest(http.MethodGet, "/static/app.js", nil), cfg)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, indexRecorder.Code)
+	assert.Contains(t, indexRecorder.Body.String(), `<script src="/static/app.js"></script>`)
+	assert.NotContains(t, indexRecorder.Body.String(), "https://")
+	assert.Equal(t, http.StatusOK, scriptRecorder.Code)
+	assert.Contains(t, scriptRecorder.Body.String(), "/getall.json")
+}
+
+func TestMetricsAreServedAsOpenMetricsWhenExemplarsEnabled(t *testing.T) {
+	// Arrange
+	enabledCfg := &config.Config{MetricsExemplars: true}
+	disabledCfg := &config.Config{}
+	enabledRecorder := httptest.NewRecorder()
+	disabledRecorder := httptest.NewRecorder()
+	newRequest := func() *http.Request {
+		request := httptest.NewRequest(http.MethodGet, "/console/metrics", nil)
+		request.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+		return request
+	}
+
+	// Act
+	metricsHandler(enabledCfg).ServeHTTP(enabledRecorder, newRequest())
+	metricsHandler(disabledCfg).ServeHTTP(disabledRecorder, newRequest())
+
+	// Assert
+	assert.Equal(t, http.StatusOK, enabledRecorder.Code)
+	assert.Contains(t, enabledRecorder.Header().Get("Content-Type"), "application/openmetrics-text")
+	assert.Contains(t, disabledRecorder.Header().Get("Content-Type"), "text/plain")
+}
@@ -0,0 +1,396 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"trace-monitor-collector/counter"
+)
+
+type Level int32
+
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Уровень подсистемы, для которой он не задан отдельно
+const levelInherit Level = -1
+
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Максимум ключей ограничения частоты на подсистему, сверх лимита предупреждения не ограничиваются
+const maxLimitedKeys = 1000
+
+var (
+	TotalSuppressedWarnings counter.CounterStruct
+)
+
+var levelNames = map[Level]string{
+	LevelTrace: "trace",
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, isExist := levelNames[l]; isExist {
+		return name
+	}
+	return strconv.Itoa(int(l))
+}
+
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return LevelWarn, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// LevelByVerbosity переводит флаги -v/-vv/-vvv в уровень, старший флаг имеет приоритет
+func LevelByVerbosity(isVerbose, isVeryVerbose, isVeryVeryVerbose bool) (Level, bool) {
+	switch {
+	case isVeryVeryVerbose:
+		return LevelTrace, true
+	case isVeryVerbose:
+		return LevelDebug, true
+	case isVerbose:
+		return LevelInfo, true
+	}
+	return 0, false
+}
+
+var (
+	outputMu      sync.Mutex
+	output        io.Writer = os.Stderr
+	isJSON        int32
+	globalLevel   = int32(LevelWarn)
+	limitInterval = int64(10 * time.Second)
+
+	registryMu sync.Mutex
+	registry   = make(map[string]*Logger)
+)
+
+func SetOutput(w io.Writer) {
+	outputMu.Lock()
+	output = w
+	outputMu.Unlock()
+}
+
+func SetFormat(format string) error {
+	switch format {
+	case "", FormatLogfmt:
+		atomic.StoreInt32(&isJSON, 0)
+	case FormatJSON:
+		atomic.StoreInt32(&isJSON, 1)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+func SetLevel(level Level) {
+	atomic.StoreInt32(&globalLevel, int32(level))
+}
+
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&globalLevel))
+}
+
+// SetWarnInterval задаёт, как часто повторяется одно и то же ограниченное предупреждение
+func SetWarnInterval(interval time.Duration) {
+	atomic.StoreInt64(&limitInterval, int64(interval))
+}
+
+// SetSubsystemLevel переопределяет уровень одной подсистемы, ResetSubsystemLevel возвращает общий
+func SetSubsystemLevel(subsystem string, level Level) {
+	New(subsystem).setLevel(level)
+}
+
+func ResetSubsystemLevel(subsystem string) {
+	New(subsystem).setLevel(levelInherit)
+}
+
+// Levels возвращает уровни всех подсистем с учётом общего уровня
+func Levels() map[string]string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	levels := make(map[string]string, len(registry))
+	for subsystem, logger := range registry {
+		levels[subsystem] = logger.Level().String()
+	}
+	return levels
+}
+
+func Subsystems() []string {
+	registryMu.Lock()
+	subsystems := make([]string, 0, len(registry))
+	for subsystem := range registry {
+		subsystems = append(subsystems, subsystem)
+	}
+	registryMu.Unlock()
+	sort.Strings(subsystems)
+	return subsystems
+}
+
+type limitState struct {
+	lastAt     time.Time
+	suppressed uint64
+}
+
+type Logger struct {
+	subsystem string
+	level     int32
+
+	limitMu sync.Mutex
+	limits  map[string]*limitState
+}
+
+// New возвращает логгер подсистемы, повторный вызов с тем же именем отдаёт тот же логгер
+func New(subsystem string) *Logger {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if logger, isExist := registry[subsystem]; isExist {
+		return logger
+	}
+	logger := &Logger{
+		subsystem: subsystem,
+		level:     int32(levelInherit),
+		limits:    make(map[string]*limitState),
+	}
+	registry[subsystem] = logger
+	return logger
+}
+
+func (l *Logger) setLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *Logger) Level() Level {
+	if level := Level(atomic.LoadInt32(&l.level)); level != levelInherit {
+		return level
+	}
+	return GetLevel()
+}
+
+// Enabled позволяет не собирать дорогие поля, если уровень всё равно отключён
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+func (l *Logger) Trace(msg string, keyValues ...interface{}) {
+	l.log(LevelTrace, msg, keyValues)
+}
+
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.log(LevelDebug, msg, keyValues)
+}
+
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.log(LevelInfo, msg, keyValues)
+}
+
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.log(LevelWarn, msg, keyValues)
+}
+
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.log(LevelError, msg, keyValues)
+}
+
+// WarnLimited пишет предупреждение не чаще раза в интервал на ключ.
+// Пропущенные за интервал повторы попадают в поле suppressed следующей записи.
+func (l *Logger) WarnLimited(key string, msg string, keyValues ...interface{}) {
+	if !l.Enabled(LevelWarn) {
+		return
+	}
+	suppressed, isAllowed := l.allow(key, time.Now())
+	if !isAllowed {
+		TotalSuppressedWarnings.Increment()
+		return
+	}
+	if suppressed > 0 {
+		keyValues = append(keyValues, "suppressed", suppressed)
+	}
+	l.log(LevelWarn, msg, keyValues)
+}
+
+func (l *Logger) allow(key string, now time.Time) (uint64, bool) {
+	interval := time.Duration(atomic.LoadInt64(&limitInterval))
+	if interval <= 0 {
+		return 0, true
+	}
+
+	l.limitMu.Lock()
+	defer l.limitMu.Unlock()
+	state, isExist := l.limits[key]
+	if !isExist {
+		if len(l.limits) >= maxLimitedKeys {
+			l.cleanupLimits(now, interval)
+			if len(l.limits) >= maxLimitedKeys {
+				return 0, true
+			}
+		}
+		l.limits[key] = &limitState{lastAt: now}
+		return 0, true
+	}
+	if now.Sub(state.lastAt) < interval {
+		state.suppressed++
+		return 0, false
+	}
+	suppressed := state.suppressed
+	state.lastAt = now
+	state.suppressed = 0
+	return suppressed, true
+}
+
+func (l *Logger) cleanupLimits(now time.Time, interval time.Duration) {
+	for key, state := range l.limits {
+		if now.Sub(state.lastAt) >= interval && state.suppressed == 0 {
+			delete(l.limits, key)
+		}
+	}
+}
+
+func (l *Logger) log(level Level, msg string, keyValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var line []byte
+	if atomic.LoadInt32(&isJSON) == 1 {
+		line = formatJSON(time.Now(), level, l.subsystem, msg, keyValues)
+	} else {
+		line = formatLogfmt(time.Now(), level, l.subsystem, msg, keyValues)
+	}
+
+	outputMu.Lock()
+	_, _ = output.Write(line)
+	outputMu.Unlock()
+}
+
+func formatLogfmt(now time.Time, level Level, subsystem string, msg string, keyValues []interface{}) []byte {
+	var builder strings.Builder
+	builder.WriteString("time=")
+	builder.WriteString(now.Format(time.RFC3339Nano))
+	builder.WriteString(" level=")
+	builder.WriteString(level.String())
+	builder.WriteString(" subsystem=")
+	builder.WriteString(logfmtValue(subsystem))
+	builder.WriteString(" msg=")
+	builder.WriteString(logfmtValue(msg))
+	for i := 0; i < len(keyValues); i += 2 {
+		key, value := pairAt(keyValues, i)
+		builder.WriteByte(' ')
+		builder.WriteString(key)
+		builder.WriteByte('=')
+		builder.WriteString(logfmtValue(stringValue(value)))
+	}
+	builder.WriteByte('\n')
+	return []byte(builder.String())
+}
+
+func formatJSON(now time.Time, level Level, subsystem string, msg string, keyValues []interface{}) []byte {
+	var builder strings.Builder
+	builder.WriteString(`{"time":`)
+	writeJSONString(&builder, now.Format(time.RFC3339Nano))
+	builder.WriteString(`,"level":`)
+	writeJSONString(&builder, level.String())
+	builder.WriteString(`,"subsystem":`)
+	writeJSONString(&builder, subsystem)
+	builder.WriteString(`,"msg":`)
+	writeJSONString(&builder, msg)
+	for i := 0; i < len(keyValues); i += 2 {
+		key, value := pairAt(keyValues, i)
+		builder.WriteByte(',')
+		writeJSONString(&builder, key)
+		builder.WriteByte(':')
+		switch typedValue := value.(type) {
+		case error, fmt.Stringer, []byte, time.Duration:
+			writeJSONString(&builder, stringValue(typedValue))
+		default:
+			valueBytes, err := json.Marshal(typedValue)
+			if err != nil {
+				writeJSONString(&builder, stringValue(typedValue))
+				continue
+			}
+			builder.Write(valueBytes)
+		}
+	}
+	builder.WriteString("}\n")
+	return []byte(builder.String())
+}
+
+func pairAt(keyValues []interface{}, i int) (string, interface{}) {
+	if i+1 >= len(keyValues) {
+		return "!badkey", keyValues[i]
+	}
+	key, isString := keyValues[i].(string)
+	if !isString {
+		key = stringValue(keyValues[i])
+	}
+	return key, keyValues[i+1]
+}
+
+func stringValue(value interface{}) string {
+	switch typedValue := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typedValue
+	case []byte:
+		return string(typedValue)
+	case error:
+		return typedValue.Error()
+	case fmt.Stringer:
+		return typedValue.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	if strings.ContainsAny(value, " =\"\t\r\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func writeJSONString(builder *strings.Builder, value string) {
+	valueBytes, _ := json.Marshal(value)
+	builder.Write(valueBytes)
+}
+
+// Configure применяет настройки из конфига, warnInterval в секундах
+func Configure(level string, format string, warnInterval time.Duration) error {
+	parsedLevel, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if err = SetFormat(format); err != nil {
+		return err
+	}
+	SetLevel(parsedLevel)
+	SetWarnInterval(warnInterval * time.Second)
+	return nil
+}
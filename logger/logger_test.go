@@ -0,0 +1,94 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"trace-monitor-collector/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelByVerbosityPrefersHighestFlag(t *testing.T) {
+	// Act
+	level, isSet := logger.LevelByVerbosity(true, false, true)
+	_, isDefaultSet := logger.LevelByVerbosity(false, false, false)
+
+	// Assert
+	assert.True(t, isSet)
+	assert.Equal(t, logger.LevelTrace, level)
+	assert.False(t, isDefaultSet)
+}
+
+func TestSubsystemLevelOverridesGlobal(t *testing.T) {
+	// Arrange
+	var output bytes.Buffer
+	logger.SetOutput(&output)
+	require.Nil(t, logger.SetFormat(logger.FormatLogfmt))
+	logger.SetLevel(logger.LevelWarn)
+	udpLog := logger.New("test-udp")
+	storeLog := logger.New("test-store")
+	logger.SetSubsystemLevel("test-udp", logger.LevelDebug)
+	defer logger.ResetSubsystemLevel("test-udp")
+
+	// Act
+	udpLog.Debug("packet read", "pid", "123", "method", "init-trace")
+	storeLog.Debug("trace stored", "pid", "123")
+
+	// Assert
+	assert.Equal(t, 1, strings.Count(output.String(), "\n"))
+	assert.Contains(t, output.String(), `level=debug subsystem=test-udp msg="packet read" pid=123 method=init-trace`)
+	assert.Equal(t, "debug", logger.Levels()["test-udp"])
+	assert.Equal(t, "warn", logger.Levels()["test-store"])
+}
+
+func TestJSONFormat(t *testing.T) {
+	// Arrange
+	var output bytes.Buffer
+	logger.SetOutput(&output)
+	require.Nil(t, logger.SetFormat(logger.FormatJSON))
+	defer logger.SetFormat(logger.FormatLogfmt)
+	logger.SetLevel(logger.LevelWarn)
+
+	// Act
+	logger.New("test-json").Error("listen failed", "port", 9000, "err", errors.New("address in use"))
+
+	// Assert
+	var record map[string]interface{}
+	require.Nil(t, json.Unmarshal(output.Bytes(), &record))
+	assert.Equal(t, "error", record["level"])
+	assert.Equal(t, "test-json", record["subsystem"])
+	assert.Equal(t, "listen failed", record["msg"])
+	assert.Equal(t, float64(9000), record["port"])
+	assert.Equal(t, "address in use", record["err"])
+}
+
+func TestWarnLimitedSuppressesRepeats(t *testing.T) {
+	// Arrange
+	var output bytes.Buffer
+	logger.SetOutput(&output)
+	require.Nil(t, logger.SetFormat(logger.FormatLogfmt))
+	logger.SetLevel(logger.LevelWarn)
+	logger.SetWarnInterval(50 * time.Millisecond)
+	defer logger.SetWarnInterval(10 * time.Second)
+	limitedLog := logger.New("test-limited")
+	suppressedBefore := logger.TotalSuppressedWarnings.Count()
+
+	// Act
+	for i := 0; i < 3; i++ {
+		limitedLog.WarnLimited("queue-full", "channel is full", "channel", 1)
+	}
+	time.Sleep(60 * time.Millisecond)
+	limitedLog.WarnLimited("queue-full", "channel is full", "channel", 1)
+
+	// Assert
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.NotContains(t, lines[0], "suppressed")
+	assert.Contains(t, lines[1], "suppressed=2")
+	assert.Equal(t, suppressedBefore+2, logger.TotalSuppressedWarnings.Count())
+}
@@ -10,6 +10,11 @@ import (
 	"os"
 	"runtime"
 	"trace-monitor-collector/config"
+	"trace-monitor-collector/logger"
+	"trace-monitor-collector/metricsPush"
+	"trace-monitor-collector/redaction"
+	"trace-monitor-collector/retention"
+	"trace-monitor-collector/traceCollection"
 )
 
 var (
@@ -48,18 +53,66 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	cfg.SetVerbosity(*IsVerbose, *IsVeryVerbose, *IsVeryVeryVerbose)
+	// Флаги -v/-vv/-vvv переопределяют log_level
+	if level, isSet := logger.LevelByVerbosity(*IsVerbose, *IsVeryVerbose, *IsVeryVeryVerbose); isSet {
+		cfg.LogLevel = level.String()
+	}
+	if err = logger.Configure(cfg.LogLevel, cfg.LogFormat, cfg.LogWarnInterval); err != nil {
+		log.Fatal(err)
+	}
+
+	traceCollection.Redactor, err = redaction.New(cfg.Redaction)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	retentionPolicy, err = retention.NewPolicy(cfg.Retention, cfg.AppName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	adminHandler, err = newAdminHandler(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fpmClientList, err := newFpmClientList(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = validateMetricsLabels(cfg); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.MetricsPush.IsEnabled() {
+		metricsPusher, err = metricsPush.New(cfg.MetricsPush, nodeName())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	registerCloseObservers(cfg)
+	registerPipelineMetrics(cfg)
 
 	runtime.SetBlockProfileRate(1)
 
-	ctx, _ := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	go handleUdp(ctx, cfg)
 
-	go handleFpmStatus(cfg)
+	go handleFpmStatus(cfg, fpmClientList)
+
+	if cfg.PidLivenessCheck {
+		go handlePidLiveness(cfg)
+	}
 
 	go handleHttp(cfg)
 
+	if cfg.MetricsAddr != "" {
+		go handleMetricsHttp(cfg)
+	}
+
 	go handlePrometheus(cfg)
 
 	<-make(chan struct{})
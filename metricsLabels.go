@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/traceCollection"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Префикс меток, в которые выносятся теги трейсов
+const tagLabelPrefix = "tag_"
+
+var (
+	nodeNameOnce   sync.Once
+	cachedNodeName string
+	traceTagLabels *tagLabelSet
+	labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	labelCharRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// Метки, которые уже используются метриками коллектора и не могут быть заданы в metrics_labels
+var reservedLabelNames = []string{
+	"node", "app", "env", "method", "pool", "pid", "state", "request_method", "request_uri",
+	"port", "reason", "routine", "rule", "decision", "source", "kind", "fingerprint", "span", "class",
+	"target", "result", "job", "instance", "le", "quantile",
+}
+
+// nodeName возвращает короткое имя хоста, вычисляется один раз за время работы процесса
+func nodeName() string {
+	nodeNameOnce.Do(func() {
+		hostname, _ := os.Hostname()
+		cachedNodeName = strings.Split(hostname, ".")[0]
+	})
+	return cachedNodeName
+}
+
+// metricsConstLabels возвращает метки node, env и дополнительные метки из metrics_labels
+func metricsConstLabels(cfg *config.Config) prometheus.Labels {
+	labels := prometheus.Labels{
+		"node": nodeName(),
+		"env":  cfg.Env,
+	}
+	for name, value := range cfg.MetricsLabels {
+		labels[name] = value
+	}
+	return labels
+}
+
+func metricsConstLabelsWithApp(cfg *config.Config) prometheus.Labels {
+	labels := metricsConstLabels(cfg)
+	labels["app"] = cfg.AppName
+	return labels
+}
+
+// validateMetricsLabels проверяет имена дополнительных меток и тегов до регистрации метрик,
+// иначе prometheus упадёт с паникой на первом же скрейпе
+func validateMetricsLabels(cfg *config.Config) error {
+	for name := range cfg.MetricsLabels {
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("metrics_labels: invalid label name %q", name)
+		}
+		if strings.HasPrefix(name, tagLabelPrefix) {
+			return fmt.Errorf("metrics_labels: label name %q uses reserved prefix %q", name, tagLabelPrefix)
+		}
+		for _, reservedName := range reservedLabelNames {
+			if name == reservedName {
+				return fmt.Errorf("metrics_labels: label name %q is reserved", name)
+			}
+		}
+	}
+	names := make(map[string]string, len(cfg.MetricsTagLabels))
+	for _, tag := range cfg.MetricsTagLabels {
+		if tag == "" {
+			return fmt.Errorf("metrics_tag_labels: empty tag name")
+		}
+		name := tagLabelName(tag)
+		if previousTag, isExist := names[name]; isExist {
+			return fmt.Errorf("metrics_tag_labels: tags %q and %q map to the same label %q", previousTag, tag, name)
+		}
+		names[name] = tag
+	}
+	return nil
+}
+
+func tagLabelName(tag string) string {
+	return tagLabelPrefix + labelCharRegex.ReplaceAllString(tag, "_")
+}
+
+// tagLabelSet выносит выбранные теги трейса в метки, число значений каждой метки ограничено
+type tagLabelSet struct {
+	tags     []string
+	names    []string
+	limiters []*labelLimiter
+}
+
+func newTagLabelSet(tags []string, maxValues int) *tagLabelSet {
+	set := &tagLabelSet{}
+	for _, tag := range tags {
+		set.tags = append(set.tags, tag)
+		set.names = append(set.names, tagLabelName(tag))
+		set.limiters = append(set.limiters, newLabelLimiter(maxValues))
+	}
+	return set
+}
+
+func (s *tagLabelSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.tags)
+}
+
+func (s *tagLabelSet) Names() []string {
+	if s == nil {
+		return nil
+	}
+	return s.names
+}
+
+// Values возвращает значения меток в порядке Names, отсутствующий тег даёт пустое значение
+func (s *tagLabelSet) Values(tags map[string]interface{}) []string {
+	if s == nil {
+		return nil
+	}
+	values := make([]string, len(s.tags))
+	for i, tag := range s.tags {
+		values[i] = s.limiters[i].Allow(tagLabelValue(tags[tag]))
+	}
+	return values
+}
+
+func tagLabelValue(value interface{}) string {
+	switch value.(type) {
+	case string, float64, bool:
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+type activeTracesByTags struct {
+	app    string
+	values []string
+	count  int
+}
+
+// countActiveTracesByTags считает открытые трейсы по приложению и значениям тегов-меток
+func countActiveTracesByTags(cfg *config.Config, labels *tagLabelSet) []activeTracesByTags {
+	countByKey := make(map[string]*activeTracesByTags)
+	traceCollection.RangeActiveTraces(func(app string, tags map[string]interface{}) {
+		app = appNameOf(cfg, app)
+		values := labels.Values(tags)
+		key := app + "\x00" + strings.Join(values, "\x00")
+		if _, isExist := countByKey[key]; !isExist {
+			countByKey[key] = &activeTracesByTags{app: app, values: values}
+		}
+		countByKey[key].count++
+	})
+	keys := make([]string, 0, len(countByKey))
+	for key := range countByKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]activeTracesByTags, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *countByKey[key])
+	}
+	return result
+}
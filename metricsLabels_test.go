@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/traceCollection"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func labelsOf(metric *dto.Metric) map[string]string {
+	labels := make(map[string]string)
+	for _, label := range metric.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	return labels
+}
+
+func TestExporterAddsExtraConstLabels(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{AppName: "app-name", Env: "prod", MetricsLabels: map[string]string{"cluster": "eu-1"}}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewExporter(cfg))
+
+	// Act
+	families, err := registry.Gather()
+
+	// Assert
+	require.Nil(t, err)
+	require.NotEmpty(t, families)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := labelsOf(metric)
+			assert.Equal(t, "eu-1", labels["cluster"], family.GetName())
+			assert.Equal(t, "prod", labels["env"], family.GetName())
+			assert.Equal(t, nodeName(), labels["node"], family.GetName())
+		}
+	}
+}
+
+func TestExporterCountsActiveTracesByTagWithValueLimit(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{AppName: "app-name", MetricsTagLabels: []string{"service"}}
+	previousTraceTagLabels := traceTagLabels
+	defer func() {
+		traceTagLabels = previousTraceTagLabels
+		traceCollection.Clear()
+		resetCounters()
+	}()
+	traceTagLabels = newTagLabelSet(cfg.MetricsTagLabels, 1)
+	traceTagLabels.Values(map[string]interface{}{"service": "checkout"})
+	sentAt := time.Now()
+	require.Nil(t, traceCollection.InitTrace(cfg, "960", "tag-trace-1", sentAt, time.Time{}, 0, []byte(`{"data":{"tags":{"service":"checkout"}}}`)))
+	require.Nil(t, traceCollection.InitTrace(cfg, "961", "tag-trace-2", sentAt, time.Time{}, 0, []byte(`{"data":{"tags":{"service":"checkout"}}}`)))
+	require.Nil(t, traceCollection.InitTrace(cfg, "962", "tag-trace-3", sentAt, time.Time{}, 0, []byte(`{"data":{"tags":{"service":"search"}}}`)))
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewExporter(cfg))
+
+	// Act
+	families, err := registry.Gather()
+
+	// Assert
+	require.Nil(t, err)
+	countByService := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "trace_monitor_count_active_traces" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := labelsOf(metric)
+			assert.Equal(t, "app-name", labels["app"])
+			countByService[labels["tag_service"]] = metric.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{"checkout": 2, overflowLabelValue: 1}, countByService)
+}
+
+func TestValidateMetricsLabelsRejectsReservedAndInvalidNames(t *testing.T) {
+	// Arrange
+	cases := map[string]*config.Config{
+		"reserved": {MetricsLabels: map[string]string{"app": "x"}},
+		"invalid":  {MetricsLabels: map[string]string{"data-center": "x"}},
+		"prefix":   {MetricsLabels: map[string]string{"tag_service": "x"}},
+		"conflict": {MetricsTagLabels: []string{"user.id", "user_id"}},
+	}
+	validCfg := &config.Config{MetricsLabels: map[string]string{"cluster": "eu-1"}, MetricsTagLabels: []string{"service", "user.id"}}
+
+	// Act
+	validErr := validateMetricsLabels(validCfg)
+
+	// Assert
+	assert.Nil(t, validErr)
+	for name, cfg := range cases {
+		assert.NotNil(t, validateMetricsLabels(cfg), name)
+	}
+}
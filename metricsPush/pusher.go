@@ -0,0 +1,142 @@
+package metricsPush
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+	"trace-monitor-collector/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Получатели метрик, они же значения метки target
+const (
+	TargetPushgateway = "pushgateway"
+	TargetRemoteWrite = "remote_write"
+	TargetStatsd      = "statsd"
+)
+
+var (
+	ErrorUnknownStatsdFormat = errors.New("metricsPush: statsd_format must be statsd or dogstatsd")
+	ErrorUnexpectedCode      = errors.New("metricsPush: unexpected status code")
+)
+
+type Pusher struct {
+	cfg        config.MetricsPush
+	instance   string
+	httpClient *http.Client
+	statsd     *Statsd
+	statsdConn net.Conn
+}
+
+// New готовит отправку на все заданные в cfg получатели, instance становится группой в Pushgateway
+func New(cfg config.MetricsPush, instance string) (*Pusher, error) {
+	pusher := &Pusher{
+		cfg:        cfg,
+		instance:   instance,
+		httpClient: &http.Client{Timeout: cfg.Timeout * time.Second},
+	}
+	if cfg.StatsdAddress != "" {
+		if cfg.StatsdFormat != StatsdFormatPlain && cfg.StatsdFormat != StatsdFormatDog {
+			return nil, ErrorUnknownStatsdFormat
+		}
+		conn, err := net.Dial("udp", cfg.StatsdAddress)
+		if err != nil {
+			return nil, err
+		}
+		pusher.statsd = NewStatsd(cfg.StatsdFormat, cfg.StatsdPrefix)
+		pusher.statsdConn = conn
+	}
+	return pusher, nil
+}
+
+// Targets возвращает заданные получатели
+func (p *Pusher) Targets() []string {
+	var targets []string
+	if p.cfg.PushgatewayURL != "" {
+		targets = append(targets, TargetPushgateway)
+	}
+	if p.cfg.RemoteWriteURL != "" {
+		targets = append(targets, TargetRemoteWrite)
+	}
+	if p.statsd != nil {
+		targets = append(targets, TargetStatsd)
+	}
+	return targets
+}
+
+// Push отправляет один снимок метрик на все получатели, ошибки возвращаются по получателям
+func (p *Pusher) Push(families []*dto.MetricFamily, now time.Time) map[string]error {
+	errorByTarget := make(map[string]error)
+	for _, target := range p.Targets() {
+		switch target {
+		case TargetPushgateway:
+			errorByTarget[target] = p.pushGateway(families)
+		case TargetRemoteWrite:
+			errorByTarget[target] = p.remoteWrite(families, now)
+		case TargetStatsd:
+			errorByTarget[target] = p.sendStatsd(families)
+		}
+	}
+	return errorByTarget
+}
+
+func (p *Pusher) pushGateway(families []*dto.MetricFamily) error {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})
+	pusher := push.New(p.cfg.PushgatewayURL, p.cfg.PushgatewayJob).
+		Gatherer(gatherer).
+		Grouping("instance", p.instance).
+		Client(p)
+	if p.cfg.BasicAuthUser != "" {
+		pusher = pusher.BasicAuth(p.cfg.BasicAuthUser, p.cfg.BasicAuthPassword)
+	}
+	return pusher.Push()
+}
+
+func (p *Pusher) remoteWrite(families []*dto.MetricFamily, now time.Time) error {
+	request, err := http.NewRequest(http.MethodPost, p.cfg.RemoteWriteURL, bytes.NewReader(EncodeWriteRequest(families, now)))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if p.cfg.BasicAuthUser != "" {
+		request.SetBasicAuth(p.cfg.BasicAuthUser, p.cfg.BasicAuthPassword)
+	}
+	response, err := p.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%w: %d", ErrorUnexpectedCode, response.StatusCode)
+	}
+	return nil
+}
+
+func (p *Pusher) sendStatsd(families []*dto.MetricFamily) error {
+	for _, packet := range Packets(p.statsd.Lines(families)) {
+		if _, err := p.statsdConn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do добавляет bearer токен к запросам в Pushgateway и remote-write
+func (p *Pusher) Do(request *http.Request) (*http.Response, error) {
+	if p.cfg.BearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+p.cfg.BearerToken)
+	}
+	return p.httpClient.Do(request)
+}
@@ -0,0 +1,136 @@
+package metricsPush_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/metricsPush"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func gatherTestMetrics(t *testing.T) []*dto.MetricFamily {
+	registry := prometheus.NewRegistry()
+	traceSet := prometheus.NewCounter(prometheus.CounterOpts{Name: "trace_monitor_total_trace_set", ConstLabels: prometheus.Labels{"app": "app-name"}})
+	traceSet.Add(3)
+	registry.MustRegister(traceSet)
+	families, err := registry.Gather()
+	require.Nil(t, err)
+	return families
+}
+
+// decodeSnappyLiterals читает поток snappy, состоящий только из литералов
+func decodeSnappyLiterals(t *testing.T, data []byte) []byte {
+	length, n := protowire.ConsumeVarint(data)
+	require.True(t, n > 0)
+	data = data[n:]
+	var decoded []byte
+	for len(data) > 0 {
+		tag := data[0]
+		require.Equal(t, byte(0), tag&3)
+		chunkLength := int(tag >> 2)
+		data = data[1:]
+		switch chunkLength {
+		case 60:
+			chunkLength = int(data[0])
+			data = data[1:]
+		case 61:
+			chunkLength = int(data[0]) | int(data[1])<<8
+			data = data[2:]
+		}
+		decoded = append(decoded, data[:chunkLength+1]...)
+		data = data[chunkLength+1:]
+	}
+	require.Equal(t, int(length), len(decoded))
+	return decoded
+}
+
+// readSeriesLabels возвращает метки первого ряда WriteRequest
+func readSeriesLabels(t *testing.T, request []byte) map[string]string {
+	_, _, n := protowire.ConsumeTag(request)
+	series, m := protowire.ConsumeBytes(request[n:])
+	require.True(t, m > 0)
+	labels := make(map[string]string)
+	for len(series) > 0 {
+		number, _, n := protowire.ConsumeTag(series)
+		value, m := protowire.ConsumeBytes(series[n:])
+		series = series[n+m:]
+		if number != 1 {
+			continue
+		}
+		_, _, nameTagLength := protowire.ConsumeTag(value)
+		name, nameLength := protowire.ConsumeString(value[nameTagLength:])
+		value = value[nameTagLength+nameLength:]
+		_, _, valueTagLength := protowire.ConsumeTag(value)
+		labelValue, _ := protowire.ConsumeString(value[valueTagLength:])
+		labels[name] = labelValue
+	}
+	return labels
+}
+
+func TestPushSendsRemoteWriteRequest(t *testing.T) {
+	// Arrange
+	var headers http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	pusher, err := metricsPush.New(config.MetricsPush{RemoteWriteURL: server.URL, BearerToken: "secret", Timeout: 5}, "node-1")
+	require.Nil(t, err)
+
+	// Act
+	errorByTarget := pusher.Push(gatherTestMetrics(t), time.Now())
+
+	// Assert
+	assert.Equal(t, map[string]error{metricsPush.TargetRemoteWrite: nil}, errorByTarget)
+	assert.Equal(t, "snappy", headers.Get("Content-Encoding"))
+	assert.Equal(t, "Bearer secret", headers.Get("Authorization"))
+	labels := readSeriesLabels(t, decodeSnappyLiterals(t, body))
+	assert.Equal(t, map[string]string{"__name__": "trace_monitor_total_trace_set", "app": "app-name"}, labels)
+}
+
+func TestPushSendsMetricsToPushgatewayGroup(t *testing.T) {
+	// Arrange
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	pusher, err := metricsPush.New(config.MetricsPush{PushgatewayURL: server.URL, PushgatewayJob: "collector", Timeout: 5}, "node-1")
+	require.Nil(t, err)
+
+	// Act
+	errorByTarget := pusher.Push(gatherTestMetrics(t), time.Now())
+
+	// Assert
+	assert.Nil(t, errorByTarget[metricsPush.TargetPushgateway])
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/collector/instance/node-1", path)
+}
+
+func TestPushReportsRemoteWriteError(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	pusher, err := metricsPush.New(config.MetricsPush{RemoteWriteURL: server.URL, Timeout: 5}, "node-1")
+	require.Nil(t, err)
+
+	// Act
+	errorByTarget := pusher.Push(gatherTestMetrics(t), time.Now())
+
+	// Assert
+	assert.ErrorIs(t, errorByTarget[metricsPush.TargetRemoteWrite], metricsPush.ErrorUnexpectedCode)
+}
@@ -0,0 +1,136 @@
+package metricsPush
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	labels      []label
+	value       float64
+	timestampMs int64
+}
+
+// EncodeWriteRequest кодирует метрики в тело запроса Prometheus remote-write 1.0:
+// protobuf prometheus.WriteRequest, сжатый snappy
+func EncodeWriteRequest(families []*dto.MetricFamily, now time.Time) []byte {
+	var request []byte
+	for _, sample := range flatten(families, now.UnixMilli()) {
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, encodeTimeSeries(sample))
+	}
+	return snappyEncode(request)
+}
+
+func encodeTimeSeries(sample sample) []byte {
+	var series []byte
+	for _, label := range sample.labels {
+		var labelBytes []byte
+		labelBytes = protowire.AppendTag(labelBytes, 1, protowire.BytesType)
+		labelBytes = protowire.AppendString(labelBytes, label.name)
+		labelBytes = protowire.AppendTag(labelBytes, 2, protowire.BytesType)
+		labelBytes = protowire.AppendString(labelBytes, label.value)
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, labelBytes)
+	}
+	var sampleBytes []byte
+	sampleBytes = protowire.AppendTag(sampleBytes, 1, protowire.Fixed64Type)
+	sampleBytes = protowire.AppendFixed64(sampleBytes, math.Float64bits(sample.value))
+	sampleBytes = protowire.AppendTag(sampleBytes, 2, protowire.VarintType)
+	sampleBytes = protowire.AppendVarint(sampleBytes, uint64(sample.timestampMs))
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sampleBytes)
+	return series
+}
+
+// flatten раскладывает семейства метрик в отдельные ряды так же, как их видит Prometheus при скрейпе:
+// гистограммы дают _bucket, _sum и _count, summary дают квантили, _sum и _count
+func flatten(families []*dto.MetricFamily, timestampMs int64) []sample {
+	var samples []sample
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			add := func(name string, value float64, extra ...label) {
+				labels := append([]label{{name: "__name__", value: name}}, extra...)
+				for _, metricLabel := range metric.GetLabel() {
+					labels = append(labels, label{name: metricLabel.GetName(), value: metricLabel.GetValue()})
+				}
+				sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+				sampleTimestampMs := timestampMs
+				if metric.TimestampMs != nil {
+					sampleTimestampMs = metric.GetTimestampMs()
+				}
+				samples = append(samples, sample{labels: labels, value: value, timestampMs: sampleTimestampMs})
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						continue
+					}
+					add(name+"_bucket", float64(bucket.GetCumulativeCount()), label{name: "le", value: formatFloat(bucket.GetUpperBound())})
+				}
+				add(name+"_bucket", float64(histogram.GetSampleCount()), label{name: "le", value: "+Inf"})
+				add(name+"_sum", histogram.GetSampleSum())
+				add(name+"_count", float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add(name, quantile.GetValue(), label{name: "quantile", value: formatFloat(quantile.GetQuantile())})
+				}
+				add(name+"_sum", summary.GetSampleSum())
+				add(name+"_count", float64(summary.GetSampleCount()))
+			}
+		}
+	}
+	return samples
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// snappyEncode упаковывает данные в блочный формат snappy одними литералами, без сжатия.
+// Это корректный поток для любого декодера snappy и не требует отдельной зависимости,
+// а тело remote-write из сотни рядов и так невелико
+func snappyEncode(data []byte) []byte {
+	encoded := protowire.AppendVarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > 65536 {
+			chunk = chunk[:65536]
+		}
+		length := len(chunk) - 1
+		switch {
+		case length < 60:
+			encoded = append(encoded, byte(length<<2))
+		case length < 1<<8:
+			encoded = append(encoded, 60<<2, byte(length))
+		default:
+			encoded = append(encoded, 61<<2, byte(length), byte(length>>8))
+		}
+		encoded = append(encoded, chunk...)
+		data = data[len(chunk):]
+	}
+	return encoded
+}
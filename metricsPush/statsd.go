@@ -0,0 +1,119 @@
+package metricsPush
+
+import (
+	"regexp"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	StatsdFormatPlain = "statsd"
+	StatsdFormatDog   = "dogstatsd"
+)
+
+// Размер UDP пакета StatsD, который проходит без фрагментации в типичной сети
+const statsdPacketSize = 1432
+
+var statsdNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_\-]`)
+
+// Statsd переводит метрики в строки StatsD. Счётчики отправляются приращением с прошлой отправки,
+// поэтому один Statsd нужно использовать для всех отправок на один адрес
+type Statsd struct {
+	format   string
+	prefix   string
+	previous map[string]float64
+}
+
+func NewStatsd(format string, prefix string) *Statsd {
+	return &Statsd{format: format, prefix: prefix, previous: make(map[string]float64)}
+}
+
+// Lines возвращает строки StatsD: счётчики как |c, гауги как |g, у гистограмм и summary отправляются _count и _sum.
+// В формате dogstatsd метки передаются тегами, в обычном statsd значения меток дописываются к имени через точку
+func (s *Statsd) Lines(families []*dto.MetricFamily) []string {
+	var lines []string
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = s.appendCounter(lines, family.GetName(), metric, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				lines = s.appendGauge(lines, family.GetName(), metric, metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				lines = s.appendGauge(lines, family.GetName(), metric, metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				lines = s.appendCounter(lines, family.GetName()+"_count", metric, float64(metric.GetHistogram().GetSampleCount()))
+				lines = s.appendCounter(lines, family.GetName()+"_sum", metric, metric.GetHistogram().GetSampleSum())
+			case dto.MetricType_SUMMARY:
+				lines = s.appendCounter(lines, family.GetName()+"_count", metric, float64(metric.GetSummary().GetSampleCount()))
+				lines = s.appendCounter(lines, family.GetName()+"_sum", metric, metric.GetSummary().GetSampleSum())
+			}
+		}
+	}
+	return lines
+}
+
+func (s *Statsd) appendCounter(lines []string, name string, metric *dto.Metric, value float64) []string {
+	name, tags := s.nameAndTags(name, metric)
+	key := name + tags
+	delta := value - s.previous[key]
+	if delta < 0 {
+		// Счётчик сброшен, например через /admin/reset-counters
+		delta = value
+	}
+	s.previous[key] = value
+	if delta == 0 {
+		return lines
+	}
+	return append(lines, name+":"+formatFloat(delta)+"|c"+tags)
+}
+
+func (s *Statsd) appendGauge(lines []string, name string, metric *dto.Metric, value float64) []string {
+	name, tags := s.nameAndTags(name, metric)
+	if value < 0 && s.format == StatsdFormatPlain {
+		// В обычном statsd гауга со знаком минус означает изменение, поэтому сначала обнуляем её
+		lines = append(lines, name+":0|g"+tags)
+	}
+	return append(lines, name+":"+formatFloat(value)+"|g"+tags)
+}
+
+func (s *Statsd) nameAndTags(name string, metric *dto.Metric) (string, string) {
+	name = s.prefix + name
+	if s.format == StatsdFormatDog {
+		tags := make([]string, 0, len(metric.GetLabel()))
+		for _, metricLabel := range metric.GetLabel() {
+			tags = append(tags, metricLabel.GetName()+":"+strings.NewReplacer(",", "_", "|", "_").Replace(metricLabel.GetValue()))
+		}
+		if len(tags) == 0 {
+			return name, ""
+		}
+		return name, "|#" + strings.Join(tags, ",")
+	}
+	for _, metricLabel := range metric.GetLabel() {
+		if metricLabel.GetValue() != "" {
+			name += "." + statsdNameRegex.ReplaceAllString(metricLabel.GetValue(), "_")
+		}
+	}
+	return name, ""
+}
+
+// Packets склеивает строки в пакеты не больше statsdPacketSize байт
+func Packets(lines []string) [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdPacketSize {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
@@ -0,0 +1,69 @@
+package metricsPush_test
+
+import (
+	"strings"
+	"testing"
+	"trace-monitor-collector/metricsPush"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsdLinesSendCounterDeltasAndGauges(t *testing.T) {
+	// Arrange
+	registry := prometheus.NewRegistry()
+	traceSet := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "total_trace_set"}, []string{"app"})
+	activePid := prometheus.NewGauge(prometheus.GaugeOpts{Name: "count_active_pid"})
+	registry.MustRegister(traceSet, activePid)
+	traceSet.WithLabelValues("billing").Add(3)
+	activePid.Set(2)
+	gather := func() []*dto.MetricFamily {
+		families, err := registry.Gather()
+		require.Nil(t, err)
+		return families
+	}
+	statsd := metricsPush.NewStatsd(metricsPush.StatsdFormatDog, "tm.")
+
+	// Act
+	firstLines := statsd.Lines(gather())
+	traceSet.WithLabelValues("billing").Add(2)
+	secondLines := statsd.Lines(gather())
+	thirdLines := statsd.Lines(gather())
+
+	// Assert
+	assert.Equal(t, []string{"tm.count_active_pid:2|g", "tm.total_trace_set:3|c|#app:billing"}, firstLines)
+	assert.Equal(t, []string{"tm.count_active_pid:2|g", "tm.total_trace_set:2|c|#app:billing"}, secondLines)
+	assert.Equal(t, []string{"tm.count_active_pid:2|g"}, thirdLines)
+}
+
+func TestStatsdPlainFormatAppendsLabelValuesToName(t *testing.T) {
+	// Arrange
+	registry := prometheus.NewRegistry()
+	skew := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "clock_skew_seconds"}, []string{"source"})
+	registry.MustRegister(skew)
+	skew.WithLabelValues("10.0.0.1").Set(-1.5)
+	families, err := registry.Gather()
+	require.Nil(t, err)
+	statsd := metricsPush.NewStatsd(metricsPush.StatsdFormatPlain, "")
+
+	// Act
+	lines := statsd.Lines(families)
+
+	// Assert
+	assert.Equal(t, []string{"clock_skew_seconds.10_0_0_1:0|g", "clock_skew_seconds.10_0_0_1:-1.5|g"}, lines)
+}
+
+func TestPacketsSplitLinesBySize(t *testing.T) {
+	// Arrange
+	line := strings.Repeat("a", 1000)
+
+	// Act
+	packets := metricsPush.Packets([]string{line, line, "b:1|c", "c:1|c"})
+
+	// Assert
+	require.Len(t, packets, 2)
+	assert.Equal(t, line, string(packets[0]))
+	assert.Equal(t, line+"\nb:1|c\nc:1|c", string(packets[1]))
+}
@@ -0,0 +1,84 @@
+package normalize
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	sqlCommentRegexp      = regexp.MustCompile(`(?s)/\*.*?\*/|--[^\n]*`)
+	sqlStringRegexp       = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	sqlNumberRegexp       = regexp.MustCompile(`-?\b\d+(?:\.\d+)?\b`)
+	sqlPlaceholderRegexp  = regexp.MustCompile(`(^|[^:])(?:\$\d+|:[a-zA-Z_][a-zA-Z0-9_]*)`)
+	sqlInListRegexp       = regexp.MustCompile(`(?i)\b(in|values)\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	sqlValuesListRegexp   = regexp.MustCompile(`(?i)\bvalues \(\?\+\)(?:\s*,\s*\((?:\s*\?\s*,?)+\))+`)
+	sqlWhitespaceRegexp   = regexp.MustCompile(`\s+`)
+	redisKeyIdRegexp      = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{32,}|\d+`)
+	redisIpRegexp         = regexp.MustCompile(`\d{1,3}(?:\.\d{1,3}){3}`)
+	redisKeylessCommands  = map[string]bool{"PING": true, "INFO": true, "MULTI": true, "EXEC": true, "DISCARD": true, "FLUSHDB": true, "FLUSHALL": true, "DBSIZE": true, "TIME": true, "SELECT": true, "AUTH": true, "QUIT": true}
+	redisScriptCommands   = map[string]bool{"EVAL": true, "EVAL_RO": true}
+	redisScriptShaCommand = map[string]bool{"EVALSHA": true, "EVALSHA_RO": true}
+)
+
+// SQL строит отпечаток запроса: без комментариев и литералов, с одним ? вместо списков IN и VALUES.
+// Идентификаторы в кавычках сохраняются, поэтому запросы к разным таблицам не склеиваются.
+func SQL(query string) string {
+	fingerprint := sqlCommentRegexp.ReplaceAllString(query, " ")
+	fingerprint = sqlStringRegexp.ReplaceAllString(fingerprint, "?")
+	fingerprint = sqlPlaceholderRegexp.ReplaceAllString(fingerprint, "$1?")
+	fingerprint = replaceOutsideQuotes(fingerprint, sqlNumberRegexp, "?")
+	fingerprint = sqlWhitespaceRegexp.ReplaceAllString(fingerprint, " ")
+	fingerprint = sqlInListRegexp.ReplaceAllString(fingerprint, "$1 (?+)")
+	fingerprint = sqlValuesListRegexp.ReplaceAllString(fingerprint, "values (?+)")
+	return strings.ToLower(strings.TrimSpace(fingerprint))
+}
+
+// Числа внутри "идентификаторов" (например "table_2023") не трогаем
+func replaceOutsideQuotes(query string, re *regexp.Regexp, replacement string) string {
+	var result strings.Builder
+	for i, part := range strings.Split(query, `"`) {
+		if i > 0 {
+			result.WriteByte('"')
+		}
+		if i%2 == 1 {
+			result.WriteString(part)
+		} else {
+			result.WriteString(re.ReplaceAllString(part, replacement))
+		}
+	}
+	return result.String()
+}
+
+// Redis строит отпечаток команды: имя команды и шаблон первого ключа с {id} вместо идентификаторов.
+// Для EVAL вместо текста скрипта используется короткий sha1, чтобы не раздувать кардинальность.
+func Redis(commandID string, arguments []interface{}) string {
+	command := strings.ToUpper(commandID)
+	if redisKeylessCommands[command] || len(arguments) == 0 {
+		return command
+	}
+	if redisScriptCommands[command] {
+		script := fmt.Sprint(arguments[0])
+		sum := sha1.Sum([]byte(script))
+		return command + " " + hex.EncodeToString(sum[:])[:8]
+	}
+	if redisScriptShaCommand[command] {
+		sha := fmt.Sprint(arguments[0])
+		if len(sha) > 8 {
+			sha = sha[:8]
+		}
+		return command + " " + sha
+	}
+	key, ok := arguments[0].(string)
+	if !ok {
+		return command
+	}
+	return command + " " + RedisKey(key)
+}
+
+func RedisKey(key string) string {
+	key = redisIpRegexp.ReplaceAllString(key, "{ip}")
+	return redisKeyIdRegexp.ReplaceAllString(key, "{id}")
+}
@@ -0,0 +1,52 @@
+package normalize_test
+
+import (
+	"testing"
+	"trace-monitor-collector/normalize"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLStripsLiteralsAndKeepsQuotedIdentifiers(t *testing.T) {
+	assert.Equal(t,
+		`select * from "user" where ("deleted_at") is null and "user_role" = ? and "user"."id" = ? limit ?`,
+		normalize.SQL(`select * from "user" where ("deleted_at") is null and "user_role" = 'basic' and "user"."id" = 3824616 limit 1`),
+	)
+	assert.Equal(t,
+		`select * from "stats_2023" where "name" = ? and "amount" > ?`,
+		normalize.SQL(`SELECT * FROM "stats_2023" WHERE "name" = 'O''Brien' AND "amount" > -10.5`),
+	)
+}
+
+func TestSQLCollapsesInAndValuesLists(t *testing.T) {
+	assert.Equal(t,
+		`select * from "car" where "id" in (?+) and "status" in (?+)`,
+		normalize.SQL(`select * from "car" where "id" in (?, ?, ?) and "status" in (1,2)`),
+	)
+	assert.Equal(t,
+		`insert into "log" ("a", "b") values (?+)`,
+		normalize.SQL(`insert into "log" ("a", "b") values (1, 'x'), (2, 'y'), (3, 'z')`),
+	)
+}
+
+func TestSQLRemovesCommentsAndWhitespace(t *testing.T) {
+	assert.Equal(t,
+		`select "id" from "rent" where "car_id" = ?`,
+		normalize.SQL("/* app:rent */ select \"id\"\n\tfrom \"rent\" -- hot path\n where \"car_id\" = $1"),
+	)
+	assert.Equal(t,
+		`select ?::text, "id" from "rent" where "user_id" = ?`,
+		normalize.SQL(`select 'a'::text, "id" from "rent" where "user_id" = :userId`),
+	)
+}
+
+func TestRedisFingerprintsKeysAndScripts(t *testing.T) {
+	assert.Equal(t, "GET rent.cache:car_address:{id}", normalize.Redis("get", []interface{}{"rent.cache:car_address:9123"}))
+	assert.Equal(t, "EXISTS user_session:{id}", normalize.Redis("exists", []interface{}{"user_session:A7526423-BD21-4DA1-9954-C172ACEB96DB"}))
+	assert.Equal(t, "EXISTS car_main_data_id_{id}", normalize.Redis("exists", []interface{}{"car_main_data_id_9123"}))
+	assert.Equal(t, "SETEX user_ip:{ip}", normalize.Redis("setex", []interface{}{"user_ip:213.87.89.109", 180, "value"}))
+	assert.Equal(t, "PING", normalize.Redis("ping", nil))
+	evalFingerprint := normalize.Redis("eval", []interface{}{"local key = KEYS[1]", 1, "user:1"})
+	assert.Equal(t, evalFingerprint, normalize.Redis("eval", []interface{}{"local key = KEYS[1]", 1, "user:2"}))
+	assert.Regexp(t, `^EVAL [0-9a-f]{8}$`, evalFingerprint)
+}
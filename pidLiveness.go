@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/logger"
+	"trace-monitor-collector/traceCollection"
+)
+
+var livenessLog = logger.New("store")
+
+func handlePidLiveness(cfg *config.Config) {
+	defer recoverRoutineHandlePidLiveness(cfg)
+
+	ticker := time.NewTicker(cfg.PidLivenessInterval * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		traceCollection.CheckingPidLiveness(cfg)
+	}
+}
+
+func recoverRoutineHandlePidLiveness(cfg *config.Config) {
+	if r := recover(); r != nil {
+		routinePanics[routinePidLiveness].Increment()
+		livenessLog.Error("handle pid liveness panic", "panic", r)
+		go handlePidLiveness(cfg)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Гистограммы конвейера приёма UDP: до registerPipelineMetrics они nil и замеры пропускаются
+var (
+	packetSize        prometheus.Histogram
+	packetParseTime   prometheus.Histogram
+	packetQueueWait   prometheus.Histogram
+	packetProcessTime prometheus.Histogram
+	totalPacketPanics counter.CounterStruct
+)
+
+func newPipelineHistogram(cfg *config.Config, name string, help string, buckets []float64) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:        name,
+		Help:        help,
+		ConstLabels: metricsConstLabelsWithApp(cfg),
+		Buckets:     buckets,
+	})
+}
+
+func registerPipelineMetrics(cfg *config.Config) {
+	packetSize = newPipelineHistogram(cfg, "trace_monitor_packet_size_bytes",
+		"Size of received UDP packets",
+		prometheus.ExponentialBuckets(64, 2, 15))
+	packetParseTime = newPipelineHistogram(cfg, "trace_monitor_packet_parse_seconds",
+		"Time to decode a UDP packet into a command",
+		prometheus.ExponentialBuckets(0.000001, 2, 16))
+	packetQueueWait = newPipelineHistogram(cfg, "trace_monitor_packet_queue_wait_seconds",
+		"Time a packet waited in the port channel between receive and processing",
+		prometheus.ExponentialBuckets(0.00001, 2, 18))
+	packetProcessTime = newPipelineHistogram(cfg, "trace_monitor_packet_processing_seconds",
+		"Time to parse and apply a UDP packet",
+		prometheus.ExponentialBuckets(0.00001, 2, 16))
+}
+
+func pipelineCollectors() []prometheus.Collector {
+	if packetSize == nil {
+		return nil
+	}
+	return []prometheus.Collector{packetSize, packetParseTime, packetQueueWait, packetProcessTime}
+}
+
+func observePacketSize(size int) {
+	if packetSize != nil {
+		packetSize.Observe(float64(size))
+	}
+}
+
+func observeSince(histogram prometheus.Histogram, startedAt time.Time) {
+	if histogram != nil {
+		histogram.Observe(time.Since(startedAt).Seconds())
+	}
+}
+
+func observeDuration(histogram prometheus.Histogram, duration time.Duration) {
+	if histogram != nil {
+		histogram.Observe(duration.Seconds())
+	}
+}
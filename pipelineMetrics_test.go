@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"trace-monitor-collector/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporterReportsChannelDepthAndCapacityByPort(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{AppName: "app-name", UdpPortStart: 20001, UdpPortEnd: 20002, UdpPortRangeCount: 2}
+	previousChannelList := channelList
+	defer func() { channelList = previousChannelList }()
+	channelList = []chan udpPacket{make(chan udpPacket, 4), make(chan udpPacket, 4)}
+	channelList[1] <- udpPacket{data: []byte(`{}`)}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewExporter(cfg))
+
+	// Act
+	families, err := registry.Gather()
+
+	// Assert
+	require.Nil(t, err)
+	depthByPort := make(map[string]float64)
+	capacityByPort := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "port" {
+					continue
+				}
+				switch family.GetName() {
+				case "trace_monitor_udp_channel_depth":
+					depthByPort[label.GetValue()] = metric.GetGauge().GetValue()
+				case "trace_monitor_udp_channel_capacity":
+					capacityByPort[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{"20001": 0, "20002": 1}, depthByPort)
+	assert.Equal(t, map[string]float64{"20001": 4, "20002": 4}, capacityByPort)
+}
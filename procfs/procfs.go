@@ -0,0 +1,50 @@
+package procfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrProcessNotFound = errors.New("procfs: process not found")
+	ErrInvalidStat     = errors.New("procfs: invalid stat format")
+)
+
+// Номер поля starttime в /proc/<pid>/stat, считая от первого поля после имени процесса
+const startTimeFieldIndex = 19
+
+// ReadStartTime возвращает время старта процесса в тиках с момента загрузки системы.
+// Пара (pid, starttime) уникальна, поэтому по ней можно отличить новый процесс от умершего с тем же pid.
+func ReadStartTime(root string, pid string) (uint64, error) {
+	statBytes, err := os.ReadFile(filepath.Join(root, pid, "stat"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrProcessNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return parseStartTime(string(statBytes))
+}
+
+func parseStartTime(stat string) (uint64, error) {
+	// Имя процесса может содержать пробелы и скобки, поэтому ищем последнюю закрывающую скобку
+	commEnd := strings.LastIndexByte(stat, ')')
+	if commEnd == -1 {
+		return 0, ErrInvalidStat
+	}
+	fields := strings.Fields(stat[commEnd+1:])
+	if len(fields) <= startTimeFieldIndex {
+		return 0, ErrInvalidStat
+	}
+	startTime, err := strconv.ParseUint(fields[startTimeFieldIndex], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidStat, err)
+	}
+
+	return startTime, nil
+}
@@ -0,0 +1,89 @@
+package procfs_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"trace-monitor-collector/procfs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeStat(t *testing.T, root string, pid string, comm string, startTime uint64) {
+	require.Nil(t, os.MkdirAll(filepath.Join(root, pid), 0o755))
+	stat := fmt.Sprintf("%s (%s) S 1 %s %s 0 -1 4194624 80 0 0 0 0 0 0 0 20 0 1 0 %d 2703360 286 18446744073709551615 0\n", pid, comm, pid, pid, startTime)
+	require.Nil(t, os.WriteFile(filepath.Join(root, pid, "stat"), []byte(stat), 0o644))
+}
+
+func TestReadStartTimeReturnsStartTimeFromStat(t *testing.T) {
+	// Arrange
+	root := t.TempDir()
+	writeStat(t, root, "2905890", "php-fpm", 31673)
+
+	// Act
+	startTime, err := procfs.ReadStartTime(root, "2905890")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(31673), startTime)
+}
+
+func TestReadStartTimeHandlesSpacesAndParenthesesInProcessName(t *testing.T) {
+	// Arrange
+	root := t.TempDir()
+	writeStat(t, root, "2905890", "php-fpm: pool (www) 1", 42)
+
+	// Act
+	startTime, err := procfs.ReadStartTime(root, "2905890")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), startTime)
+}
+
+func TestReadStartTimeReturnsErrorWhenProcessNotFound(t *testing.T) {
+	// Arrange
+	root := t.TempDir()
+
+	// Act
+	_, err := procfs.ReadStartTime(root, "2905890")
+
+	// Assert
+	assert.ErrorIs(t, err, procfs.ErrProcessNotFound)
+}
+
+func TestReadStartTimeReturnsErrorWhenStatIsTruncated(t *testing.T) {
+	// Arrange
+	root := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "2905890"), 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(root, "2905890", "stat"), []byte("2905890 (php-fpm) S 1"), 0o644))
+
+	// Act
+	_, err := procfs.ReadStartTime(root, "2905890")
+
+	// Assert
+	assert.ErrorIs(t, err, procfs.ErrInvalidStat)
+}
+
+func TestReadUdpSocketStatsSumsQueueAndDropsByPort(t *testing.T) {
+	// Arrange
+	root := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "net"), 0o755))
+	udp := "   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n" +
+		"  1: 00000000:4E21 00000000:0000 07 00000000:00000200 00:00000000 00000000     0        0 31337 2 0000000000000000 17\n" +
+		"  2: 0100007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 31338 2 0000000000000000 0\n"
+	udp6 := "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n" +
+		"  3: 00000000000000000000000000000000:4E21 00000000000000000000000000000000:0000 07 00000000:00000100 00:00000000 00000000     0        0 31339 2 0000000000000000 3\n"
+	require.Nil(t, os.WriteFile(filepath.Join(root, "net", "udp"), []byte(udp), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(root, "net", "udp6"), []byte(udp6), 0o644))
+
+	// Act
+	stats, err := procfs.ReadUdpSocketStats(root)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, procfs.UdpSocketStat{RxQueue: 0x300, Drops: 20}, stats[20001])
+	assert.Equal(t, procfs.UdpSocketStat{}, stats[53])
+}
@@ -0,0 +1,76 @@
+package procfs
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// UdpSocketStat - состояние UDP сокетов на локальном порту по данным ядра
+type UdpSocketStat struct {
+	RxQueue uint64 // Байт в приёмном буфере сокета, ещё не прочитанных приложением
+	Drops   uint64 // Пакетов, отброшенных ядром из-за переполнения буфера
+}
+
+// ReadUdpSocketStats читает net/udp и net/udp6 сетевого пространства текущего процесса
+// и суммирует очередь и потери по локальным портам.
+func ReadUdpSocketStats(root string) (map[int]UdpSocketStat, error) {
+	stats := make(map[int]UdpSocketStat)
+	var isRead bool
+	for _, name := range []string{"udp", "udp6"} {
+		file, err := os.Open(filepath.Join(root, "net", name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = parseUdpSockets(file, stats)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		isRead = true
+	}
+	if !isRead {
+		return nil, os.ErrNotExist
+	}
+	return stats, nil
+}
+
+func parseUdpSockets(file *os.File, stats map[int]UdpSocketStat) error {
+	scanner := bufio.NewScanner(file)
+	// Первая строка - заголовок
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		addressParts := strings.Split(fields[1], ":")
+		queueParts := strings.Split(fields[4], ":")
+		if len(addressParts) != 2 || len(queueParts) != 2 {
+			continue
+		}
+		port, err := strconv.ParseUint(addressParts[1], 16, 16)
+		if err != nil {
+			continue
+		}
+		rxQueue, err := strconv.ParseUint(queueParts[1], 16, 64)
+		if err != nil {
+			continue
+		}
+		drops, err := strconv.ParseUint(fields[12], 10, 64)
+		if err != nil {
+			continue
+		}
+		stat := stats[int(port)]
+		stat.RxQueue += rxQueue
+		stat.Drops += drops
+		stats[int(port)] = stat
+	}
+	return scanner.Err()
+}
@@ -1,14 +1,118 @@
 package main
 
 import (
-	"os"
-	"strings"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 	"trace-monitor-collector/config"
+	"trace-monitor-collector/failures"
+	"trace-monitor-collector/logger"
+	"trace-monitor-collector/procfs"
+	"trace-monitor-collector/redaction"
+	"trace-monitor-collector/reorder"
+	"trace-monitor-collector/skew"
+	"trace-monitor-collector/stats"
+	"trace-monitor-collector/stream"
 	"trace-monitor-collector/traceCollection"
+	"unicode/utf8"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const (
+	overflowLabelValue   = "__other__"
+	exemplarTraceIdLabel = "traceId"
+)
+
+var (
+	queryDuration           *prometheus.HistogramVec
+	queryFingerprintLimiter *labelLimiter
+	traceErrors             *prometheus.CounterVec
+	droppedTraces           *prometheus.CounterVec
+	errorSpanLimiter        *labelLimiter
+	errorClassLimiter       *labelLimiter
+	traceDuration           *prometheus.HistogramVec
+)
+
+// labelLimiter ограничивает число различных значений метки, новые значения сверх лимита попадают в overflowLabelValue
+type labelLimiter struct {
+	mu     sync.Mutex
+	values map[string]struct{}
+	max    int
+}
+
+func newLabelLimiter(max int) *labelLimiter {
+	return &labelLimiter{values: make(map[string]struct{}), max: max}
+}
+
+func (l *labelLimiter) Allow(value string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, isExist := l.values[value]; isExist {
+		return value
+	}
+	if len(l.values) >= l.max {
+		return overflowLabelValue
+	}
+	l.values[value] = struct{}{}
+	return value
+}
+
+// observeWithTraceId добавляет к замеру OpenMetrics exemplar с traceId.
+// Гистограмма хранит последний exemplar каждого бакета, так что в верхних бакетах остаются медленные трейсы
+func observeWithTraceId(cfg *config.Config, observer prometheus.Observer, value float64, traceId string) {
+	exemplarObserver, isExemplarObserver := observer.(prometheus.ExemplarObserver)
+	// Слишком длинный exemplar client_golang не принимает и паникует
+	if !cfg.MetricsExemplars || traceId == "" || !isExemplarObserver ||
+		utf8.RuneCountInString(exemplarTraceIdLabel+traceId) > prometheus.ExemplarMaxRunes {
+		observer.Observe(value)
+		return
+	}
+	exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{exemplarTraceIdLabel: traceId})
+}
+
+// metricsHandler отдаёт метрики как promhttp.Handler, с metrics_exemplars дополнительно в формате OpenMetrics
+func metricsHandler(cfg *config.Config) http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: cfg.MetricsExemplars}))
+}
+
+func newQueryDurationHistogram(cfg *config.Config) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "trace_monitor_query_duration_seconds",
+		Help:        "Duration of SQL queries and Redis commands grouped by app and normalized fingerprint",
+		ConstLabels: metricsConstLabels(cfg),
+		Buckets:     prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"app", "kind", "fingerprint"})
+}
+
+func newTraceErrorsCounter(cfg *config.Config) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "trace_monitor_total_trace_errors",
+		Help:        "Total errors reported by traces grouped by app, span name, error class and trace tags",
+		ConstLabels: metricsConstLabels(cfg),
+	}, append([]string{"app", "span", "class"}, traceTagLabels.Names()...))
+}
+
+func newDroppedTracesCounter(cfg *config.Config) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "trace_monitor_total_dropped_traces",
+		Help:        "Total traces removed without free-pid grouped by app and reason",
+		ConstLabels: metricsConstLabels(cfg),
+	}, []string{"app", "reason"})
+}
+
+func newTraceDurationHistogram(cfg *config.Config) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "trace_monitor_trace_duration_seconds",
+		Help:        "Duration of closed traces grouped by app and trace tags",
+		ConstLabels: metricsConstLabels(cfg),
+		Buckets:     prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, append([]string{"app"}, traceTagLabels.Names()...))
+}
+
 type metricsStruct struct {
 	cfg                 *config.Config
 	TotalTraceSet       *prometheus.Desc
@@ -19,52 +123,317 @@ type metricsStruct struct {
 	TotalPackagesParse  *prometheus.Desc
 	CountActivePid      *prometheus.Desc
 	TotalChannelReset   *prometheus.Desc
+	TotalPidReuse       *prometheus.Desc
+	TotalPidDead        *prometheus.Desc
+	CountActivePidPool  *prometheus.Desc
+	TotalRedactedFields *prometheus.Desc
+	TotalReordered      *prometheus.Desc
+	TotalDuplicate      *prometheus.Desc
+	TotalLate           *prometheus.Desc
+	CountReorderPending *prometheus.Desc
+	CountSubscribers    *prometheus.Desc
+	TotalStreamDropped  *prometheus.Desc
+	TotalSeqPackets     *prometheus.Desc
+	TotalLostPackets    *prometheus.Desc
+	CountIncomplete     *prometheus.Desc
+	ClockSkew           *prometheus.Desc
+	TotalCommands       *prometheus.Desc
+	TotalFailedTraces   *prometheus.Desc
+	TotalRetention      *prometheus.Desc
+	StoreBytes          *prometheus.Desc
+	TotalEvicted        *prometheus.Desc
+	TotalTruncated      *prometheus.Desc
+	CountRetained       *prometheus.Desc
+	TotalSkewWarnings   *prometheus.Desc
+	TotalLogSuppressed  *prometheus.Desc
+	UdpListeners        *prometheus.Desc
+	UdpReaders          *prometheus.Desc
+	FpmLastSuccess      *prometheus.Desc
+	TotalRoutinePanics  *prometheus.Desc
+	Ready               *prometheus.Desc
+	ChannelDepth        *prometheus.Desc
+	ChannelCapacity     *prometheus.Desc
+	SocketRxQueue       *prometheus.Desc
+	TotalSocketDrops    *prometheus.Desc
+	TotalPacketPanics   *prometheus.Desc
+	TotalMetricsPush    *prometheus.Desc
+	CountActiveTraces   *prometheus.Desc
+	FpmPoolGauges       map[string]*prometheus.Desc
+	FpmPoolCounters     map[string]*prometheus.Desc
+	FpmProcessGauges    map[string]*prometheus.Desc
+	FpmProcesses        *prometheus.Desc
+	fpmUriLimiter       *labelLimiter
+}
+
+// Поля статуса FPM пула и имена метрик, в которые они экспортируются
+var (
+	fpmPoolGaugeFields = map[string]string{
+		"listen queue":         "trace_monitor_fpm_listen_queue",
+		"max listen queue":     "trace_monitor_fpm_max_listen_queue",
+		"listen queue len":     "trace_monitor_fpm_listen_queue_len",
+		"idle processes":       "trace_monitor_fpm_idle_processes",
+		"active processes":     "trace_monitor_fpm_active_processes",
+		"total processes":      "trace_monitor_fpm_total_processes",
+		"max active processes": "trace_monitor_fpm_max_active_processes",
+	}
+	fpmPoolCounterFields = map[string]string{
+		"accepted conn":        "trace_monitor_fpm_accepted_conn",
+		"max children reached": "trace_monitor_fpm_max_children_reached",
+		"slow requests":        "trace_monitor_fpm_slow_requests",
+	}
+	fpmProcessGaugeFields = map[string]string{
+		"requests":            "trace_monitor_fpm_process_requests",
+		"request duration":    "trace_monitor_fpm_process_request_duration_microseconds",
+		"last request cpu":    "trace_monitor_fpm_process_last_request_cpu",
+		"last request memory": "trace_monitor_fpm_process_last_request_memory_bytes",
+	}
+)
+
+func newFpmDescList(fields map[string]string, helpSuffix string, labels []string, constLabels prometheus.Labels) map[string]*prometheus.Desc {
+	descList := make(map[string]*prometheus.Desc, len(fields))
+	for field, name := range fields {
+		descList[field] = prometheus.NewDesc(name,
+			"FPM status \""+field+"\" value"+helpSuffix,
+			labels,
+			constLabels,
+		)
+	}
+	return descList
 }
 
 func NewExporter(cfg *config.Config) *metricsStruct {
-	return &metricsStruct{
+	constLabels := metricsConstLabels(cfg)
+	exporter := &metricsStruct{
 		cfg: cfg,
 		TotalTraceSet: prometheus.NewDesc("trace_monitor_total_trace_set",
 			"Total traces processed by trace Monitor",
-			[]string{"node", "app", "env"},
-			nil,
+			[]string{"app"},
+			constLabels,
 		),
 		TotalSpanSet: prometheus.NewDesc("trace_monitor_total_span_set",
 			"Total number of spans set in trace monitor",
-			[]string{"node", "app", "env"},
-			nil,
+			[]string{"app"},
+			constLabels,
 		),
 		TotalAllSpanClose: prometheus.NewDesc("trace_monitor_total_all_span_close",
 			"Total count of closed spans in trace Monitor",
-			[]string{"node", "app", "env"},
-			nil,
+			[]string{"app"},
+			constLabels,
 		),
 		TotalTraceDelete: prometheus.NewDesc("trace_monitor_total_trace_delete",
 			"Total deleted traces count in trace Monitor",
-			[]string{"node", "app", "env"},
-			nil,
+			[]string{"app"},
+			constLabels,
 		),
 		TotalPackagesCaught: prometheus.NewDesc("trace_monitor_total_packages_caught",
 			"Total caught packages monitored by trace monitor",
-			[]string{"node", "app", "env"},
-			nil,
+			[]string{"app"},
+			constLabels,
 		),
 		TotalPackagesParse: prometheus.NewDesc("trace_monitor_total_packages_parse",
 			"Total caught packages monitored by trace monitor",
-			[]string{"node", "app", "env"},
-			nil,
+			[]string{"app"},
+			constLabels,
 		),
 		CountActivePid: prometheus.NewDesc("trace_monitor_count_active_pid",
 			"Number of active PIDs in the trace monitoring",
-			[]string{"node", "app", "env"},
-			nil,
+			[]string{"app"},
+			constLabels,
 		),
 		TotalChannelReset: prometheus.NewDesc("trace_monitor_total_channel_reset",
 			"Total resets of the package channel",
-			[]string{"node", "app", "env"},
-			nil,
+			[]string{"app"},
+			constLabels,
+		),
+		TotalPidReuse: prometheus.NewDesc("trace_monitor_total_pid_reuse",
+			"Total traces evicted because their pid was reused by a new process",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalPidDead: prometheus.NewDesc("trace_monitor_total_pid_dead",
+			"Total traces evicted because their process is no longer running",
+			[]string{"app"},
+			constLabels,
+		),
+		CountActivePidPool: prometheus.NewDesc("trace_monitor_count_active_pid_by_pool",
+			"Number of active PIDs in the trace monitoring by FPM pool",
+			[]string{"app", "pool"},
+			constLabels,
+		),
+		TotalRedactedFields: prometheus.NewDesc("trace_monitor_total_redacted_fields",
+			"Total fields masked by redaction rules",
+			[]string{"app", "rule"},
+			constLabels,
+		),
+		TotalReordered: prometheus.NewDesc("trace_monitor_total_reordered",
+			"Total packets put back in sentAt order by the reorder buffer",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalDuplicate: prometheus.NewDesc("trace_monitor_total_duplicate",
+			"Total duplicate packets dropped by the reorder buffer",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalLate: prometheus.NewDesc("trace_monitor_total_late",
+			"Total packets dropped because they arrived after the reorder window for newer packets had closed",
+			[]string{"app"},
+			constLabels,
+		),
+		CountReorderPending: prometheus.NewDesc("trace_monitor_count_reorder_pending",
+			"Number of packets waiting in the reorder buffer",
+			[]string{"app"},
+			constLabels,
+		),
+		CountSubscribers: prometheus.NewDesc("trace_monitor_count_stream_subscribers",
+			"Number of connected /stream subscribers",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalStreamDropped: prometheus.NewDesc("trace_monitor_total_stream_dropped",
+			"Total stream events dropped because a subscriber buffer was full",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalSeqPackets: prometheus.NewDesc("trace_monitor_total_seq_packets",
+			"Total packets received with a sequence number",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalLostPackets: prometheus.NewDesc("trace_monitor_total_lost_packets",
+			"Estimated packets lost between clients and the collector, by gaps in sequence numbers",
+			[]string{"app"},
+			constLabels,
+		),
+		CountIncomplete: prometheus.NewDesc("trace_monitor_count_incomplete_traces",
+			"Number of active traces with lost packets",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalFailedTraces: prometheus.NewDesc("trace_monitor_total_failed_traces",
+			"Total finished traces that reported at least one error",
+			[]string{"app"},
+			constLabels,
+		),
+		StoreBytes: prometheus.NewDesc("trace_monitor_store_bytes",
+			"Approximate bytes of trace payloads held in the store",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalEvicted: prometheus.NewDesc("trace_monitor_total_evicted",
+			"Total traces evicted from the store by store_max_entries, store_max_bytes or the admin API",
+			[]string{"app", "reason"},
+			constLabels,
+		),
+		TotalTruncated: prometheus.NewDesc("trace_monitor_total_truncated_fields",
+			"Total payload fields truncated by max_field_bytes",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalRetention: prometheus.NewDesc("trace_monitor_total_retention",
+			"Total finished traces kept or dropped by retention rules",
+			[]string{"app", "rule", "decision"},
+			constLabels,
+		),
+		CountRetained: prometheus.NewDesc("trace_monitor_count_retained_traces",
+			"Number of finished traces held for /trace/by-id",
+			[]string{"app"},
+			constLabels,
 		),
+		TotalCommands: prometheus.NewDesc("trace_monitor_total_commands",
+			"Total UDP commands by method, methods without a handler are counted as \""+unknownCommandMethod+"\"",
+			[]string{"app", "method"},
+			constLabels,
+		),
+		ClockSkew: prometheus.NewDesc("trace_monitor_clock_skew_seconds",
+			"Smoothed difference between packet receive time and sentAt, by source address",
+			[]string{"app", "source"},
+			constLabels,
+		),
+		TotalSkewWarnings: prometheus.NewDesc("trace_monitor_total_clock_skew_warnings",
+			"Total times a source clock skew exceeded clock_skew_warn_ms",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalLogSuppressed: prometheus.NewDesc("trace_monitor_total_log_suppressed_warnings",
+			"Total repeated warnings not written to the log by rate limiting",
+			[]string{"app"},
+			constLabels,
+		),
+		UdpListeners: prometheus.NewDesc("trace_monitor_udp_listeners",
+			"Bound UDP listeners",
+			[]string{"app"},
+			constLabels,
+		),
+		UdpReaders: prometheus.NewDesc("trace_monitor_udp_readers",
+			"Running UDP channel readers",
+			[]string{"app"},
+			constLabels,
+		),
+		FpmLastSuccess: prometheus.NewDesc("trace_monitor_fpm_last_success_timestamp_seconds",
+			"Time of the last FPM status poll in which at least one pool answered",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalRoutinePanics: prometheus.NewDesc("trace_monitor_total_routine_panics",
+			"Total panics recovered in background routines, each followed by a restart of the routine",
+			[]string{"app", "routine"},
+			constLabels,
+		),
+		Ready: prometheus.NewDesc("trace_monitor_ready",
+			"1 when the collector is ready as reported by /readyz",
+			[]string{"app"},
+			constLabels,
+		),
+		ChannelDepth: prometheus.NewDesc("trace_monitor_udp_channel_depth",
+			"Packets waiting in the channel between the UDP socket and its reader, by port",
+			[]string{"app", "port"},
+			constLabels,
+		),
+		ChannelCapacity: prometheus.NewDesc("trace_monitor_udp_channel_capacity",
+			"Capacity of the channel between the UDP socket and its reader (packets_size), by port",
+			[]string{"app", "port"},
+			constLabels,
+		),
+		SocketRxQueue: prometheus.NewDesc("trace_monitor_udp_socket_rx_queue_bytes",
+			"Bytes waiting in the kernel receive buffer of the UDP socket, by port",
+			[]string{"app", "port"},
+			constLabels,
+		),
+		TotalSocketDrops: prometheus.NewDesc("trace_monitor_total_udp_socket_drops",
+			"Total packets dropped by the kernel because the UDP socket receive buffer was full, by port",
+			[]string{"app", "port"},
+			constLabels,
+		),
+		TotalPacketPanics: prometheus.NewDesc("trace_monitor_total_packet_panics",
+			"Total panics recovered while processing a single packet",
+			[]string{"app"},
+			constLabels,
+		),
+		TotalMetricsPush: prometheus.NewDesc("trace_monitor_total_metrics_push",
+			"Total metrics pushes by target and result",
+			[]string{"app", "target", "result"},
+			constLabels,
+		),
+		FpmPoolGauges:    newFpmDescList(fpmPoolGaugeFields, "", []string{"app", "pool"}, constLabels),
+		FpmPoolCounters:  newFpmDescList(fpmPoolCounterFields, "", []string{"app", "pool"}, constLabels),
+		FpmProcessGauges: newFpmDescList(fpmProcessGaugeFields, " summed over pool processes in the state", []string{"app", "pool", "state"}, constLabels),
+		FpmProcesses: prometheus.NewDesc("trace_monitor_fpm_processes",
+			"Count of FPM processes by state and normalized current request",
+			[]string{"app", "pool", "state", "request_method", "request_uri"},
+			constLabels,
+		),
+		fpmUriLimiter: newLabelLimiter(cfg.FpmUriMetricsMaxKeys),
+	}
+	// Открытые трейсы по тегам отдаются, только если заданы metrics_tag_labels: без них это дубль CountActivePid
+	if traceTagLabels.Len() > 0 {
+		exporter.CountActiveTraces = prometheus.NewDesc("trace_monitor_count_active_traces",
+			"Count of open traces grouped by app and trace tags",
+			append([]string{"app"}, traceTagLabels.Names()...),
+			constLabels,
+		)
 	}
+	return exporter
 }
 
 func (collector *metricsStruct) Describe(ch chan<- *prometheus.Desc) {
@@ -72,30 +441,210 @@ func (collector *metricsStruct) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (collector *metricsStruct) Collect(ch chan<- prometheus.Metric) {
-	hostname, _ := os.Hostname()
-	node := strings.Split(hostname, ".")[0]
 	app := collector.cfg.AppName
-	env := collector.cfg.Env
-
-	m1 := prometheus.MustNewConstMetric(collector.TotalTraceSet, prometheus.CounterValue, float64(traceCollection.TotalTraceSet.Count()), node, app, env)
-	ch <- m1
-	m2 := prometheus.MustNewConstMetric(collector.TotalSpanSet, prometheus.CounterValue, float64(traceCollection.TotalSpanSet.Count()), node, app, env)
-	ch <- m2
-	m3 := prometheus.MustNewConstMetric(collector.TotalAllSpanClose, prometheus.CounterValue, float64(traceCollection.TotalAllSpanClose.Count()), node, app, env)
-	ch <- m3
-	m4 := prometheus.MustNewConstMetric(collector.TotalTraceDelete, prometheus.CounterValue, float64(traceCollection.TotalTraceDelete.Count()), node, app, env)
-	ch <- m4
-	m5 := prometheus.MustNewConstMetric(collector.TotalPackagesCaught, prometheus.CounterValue, float64(totalPackagesCaught.Count()), node, app, env)
+
+	// Счётчики трейсов отдаются по приложениям из envelope, пакеты без app считаются приложением из конфига
+	for tenant, counters := range traceCollection.CountersByApp() {
+		tenantApp := appNameOf(collector.cfg, tenant)
+		ch <- prometheus.MustNewConstMetric(collector.TotalTraceSet, prometheus.CounterValue, float64(counters.TraceSet.Count()), tenantApp)
+		ch <- prometheus.MustNewConstMetric(collector.TotalSpanSet, prometheus.CounterValue, float64(counters.SpanSet.Count()), tenantApp)
+		ch <- prometheus.MustNewConstMetric(collector.TotalAllSpanClose, prometheus.CounterValue, float64(counters.AllSpanClose.Count()), tenantApp)
+		ch <- prometheus.MustNewConstMetric(collector.TotalTraceDelete, prometheus.CounterValue, float64(counters.TraceDelete.Count()), tenantApp)
+	}
+	m5 := prometheus.MustNewConstMetric(collector.TotalPackagesCaught, prometheus.CounterValue, float64(totalPackagesCaught.Count()), app)
 	ch <- m5
-	m6 := prometheus.MustNewConstMetric(collector.TotalPackagesParse, prometheus.CounterValue, float64(totalPackagesParse.Count()), node, app, env)
+	m6 := prometheus.MustNewConstMetric(collector.TotalPackagesParse, prometheus.CounterValue, float64(totalPackagesParse.Count()), app)
 	ch <- m6
-	m7 := prometheus.MustNewConstMetric(collector.CountActivePid, prometheus.GaugeValue, float64(traceCollection.CountActivePid.Count()), node, app, env)
-	ch <- m7
-	m8 := prometheus.MustNewConstMetric(collector.TotalChannelReset, prometheus.CounterValue, float64(totalChannelReset.Count()), node, app, env)
+	m8 := prometheus.MustNewConstMetric(collector.TotalChannelReset, prometheus.CounterValue, float64(totalChannelReset.Count()), app)
 	ch <- m8
+	m9 := prometheus.MustNewConstMetric(collector.TotalPidReuse, prometheus.CounterValue, float64(traceCollection.TotalPidReuse.Count()), app)
+	ch <- m9
+	m10 := prometheus.MustNewConstMetric(collector.TotalPidDead, prometheus.CounterValue, float64(traceCollection.TotalPidDead.Count()), app)
+	ch <- m10
+	for tenant, countByPool := range traceCollection.CountActivePidByAppPool() {
+		tenantApp := appNameOf(collector.cfg, tenant)
+		var countActivePid uint64
+		for pool, count := range countByPool {
+			countActivePid += count
+			if pool == "" {
+				pool = "unknown"
+			}
+			ch <- prometheus.MustNewConstMetric(collector.CountActivePidPool, prometheus.GaugeValue, float64(count), tenantApp, pool)
+		}
+		ch <- prometheus.MustNewConstMetric(collector.CountActivePid, prometheus.GaugeValue, float64(countActivePid), tenantApp)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.TotalRedactedFields, prometheus.CounterValue, float64(redaction.TotalRedactedByKey.Count()), app, "key")
+	ch <- prometheus.MustNewConstMetric(collector.TotalRedactedFields, prometheus.CounterValue, float64(redaction.TotalRedactedByPath.Count()), app, "path")
+	ch <- prometheus.MustNewConstMetric(collector.TotalRedactedFields, prometheus.CounterValue, float64(redaction.TotalRedactedByPattern.Count()), app, "pattern")
+	ch <- prometheus.MustNewConstMetric(collector.TotalReordered, prometheus.CounterValue, float64(reorder.TotalReordered.Count()), app)
+	ch <- prometheus.MustNewConstMetric(collector.TotalDuplicate, prometheus.CounterValue, float64(reorder.TotalDuplicate.Count()), app)
+	ch <- prometheus.MustNewConstMetric(collector.TotalLate, prometheus.CounterValue, float64(reorder.TotalLate.Count()), app)
+	if reorderBuffer != nil {
+		ch <- prometheus.MustNewConstMetric(collector.CountReorderPending, prometheus.GaugeValue, float64(reorderBuffer.Pending()), app)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.CountSubscribers, prometheus.GaugeValue, float64(stream.CountSubscribers.Count()), app)
+	ch <- prometheus.MustNewConstMetric(collector.TotalStreamDropped, prometheus.CounterValue, float64(stream.TotalEventsDropped.Count()), app)
+	ch <- prometheus.MustNewConstMetric(collector.TotalSeqPackets, prometheus.CounterValue, float64(traceCollection.TotalSeqPackets.Count()), app)
+	ch <- prometheus.MustNewConstMetric(collector.TotalLostPackets, prometheus.CounterValue, float64(traceCollection.TotalLostPackets.Count()), app)
+	ch <- prometheus.MustNewConstMetric(collector.CountIncomplete, prometheus.GaugeValue, float64(traceCollection.CountIncompleteTraces()), app)
+	if clockSkew != nil {
+		for _, sourceSkew := range clockSkew.Snapshot(time.Now()) {
+			ch <- prometheus.MustNewConstMetric(collector.ClockSkew, prometheus.GaugeValue, sourceSkew.Offset.Seconds(), app, sourceSkew.Source)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(collector.TotalFailedTraces, prometheus.CounterValue, float64(failures.TotalFailedTraces.Count()), app)
+	ch <- prometheus.MustNewConstMetric(collector.StoreBytes, prometheus.GaugeValue, float64(traceCollection.BytesHeld()), app)
+	ch <- prometheus.MustNewConstMetric(collector.TotalEvicted, prometheus.CounterValue, float64(traceCollection.TotalEvictedByEntries.Count()), app, "entries")
+	ch <- prometheus.MustNewConstMetric(collector.TotalEvicted, prometheus.CounterValue, float64(traceCollection.TotalEvictedByBytes.Count()), app, "bytes")
+	ch <- prometheus.MustNewConstMetric(collector.TotalEvicted, prometheus.CounterValue, float64(traceCollection.TotalEvictedByAdmin.Count()), app, "admin")
+	ch <- prometheus.MustNewConstMetric(collector.TotalTruncated, prometheus.CounterValue, float64(traceCollection.TotalTruncatedFields.Count()), app)
+	if retainedTraceStore != nil {
+		kept, dropped := retentionPolicy.CountByRule()
+		for rule, count := range kept {
+			ch <- prometheus.MustNewConstMetric(collector.TotalRetention, prometheus.CounterValue, float64(count), app, rule, "kept")
+		}
+		for rule, count := range dropped {
+			ch <- prometheus.MustNewConstMetric(collector.TotalRetention, prometheus.CounterValue, float64(count), app, rule, "dropped")
+		}
+		ch <- prometheus.MustNewConstMetric(collector.CountRetained, prometheus.GaugeValue, float64(retainedTraceStore.Len()), app)
+	}
+	for method, count := range countCommandsByMethod() {
+		ch <- prometheus.MustNewConstMetric(collector.TotalCommands, prometheus.CounterValue, float64(count), app, method)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.TotalCommands, prometheus.CounterValue, float64(totalUnknownCommand.Count()), app, unknownCommandMethod)
+	ch <- prometheus.MustNewConstMetric(collector.TotalSkewWarnings, prometheus.CounterValue, float64(skew.TotalSkewWarnings.Count()), app)
+	ch <- prometheus.MustNewConstMetric(collector.TotalLogSuppressed, prometheus.CounterValue, float64(logger.TotalSuppressedWarnings.Count()), app)
+	if collector.CountActiveTraces != nil {
+		for _, active := range countActiveTracesByTags(collector.cfg, traceTagLabels) {
+			ch <- prometheus.MustNewConstMetric(collector.CountActiveTraces, prometheus.GaugeValue, float64(active.count), append([]string{active.app}, active.values...)...)
+		}
+	}
+	if metricsPusher != nil {
+		for _, target := range metricsPusher.Targets() {
+			ch <- prometheus.MustNewConstMetric(collector.TotalMetricsPush, prometheus.CounterValue, float64(metricsPushTotals[target].Ok.Count()), app, target, "ok")
+			ch <- prometheus.MustNewConstMetric(collector.TotalMetricsPush, prometheus.CounterValue, float64(metricsPushTotals[target].Failed.Count()), app, target, "failed")
+		}
+	}
+	collector.collectHealth(ch, app)
+	collector.collectPipeline(ch, app)
+	collector.collectFpmStatus(ch, app)
+}
+
+func (collector *metricsStruct) collectHealth(ch chan<- prometheus.Metric, app string) {
+	report, _, isReady := buildHealthReport(collector.cfg, time.Now())
+	ch <- prometheus.MustNewConstMetric(collector.UdpListeners, prometheus.GaugeValue, float64(report.Udp.Listeners), app)
+	ch <- prometheus.MustNewConstMetric(collector.UdpReaders, prometheus.GaugeValue, float64(report.Udp.Readers), app)
+	if report.Fpm.LastSuccessAt != nil {
+		ch <- prometheus.MustNewConstMetric(collector.FpmLastSuccess, prometheus.GaugeValue, float64(report.Fpm.LastSuccessAt.UnixNano())/1e9, app)
+	}
+	for routine, count := range report.Panics {
+		ch <- prometheus.MustNewConstMetric(collector.TotalRoutinePanics, prometheus.CounterValue, float64(count), app, routine)
+	}
+	var ready float64
+	if isReady {
+		ready = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collector.Ready, prometheus.GaugeValue, ready, app)
+}
+
+func (collector *metricsStruct) collectPipeline(ch chan<- prometheus.Metric, app string) {
+	ch <- prometheus.MustNewConstMetric(collector.TotalPacketPanics, prometheus.CounterValue, float64(totalPacketPanics.Count()), app)
+	for channelKey, channel := range channelList {
+		port := strconv.Itoa(collector.cfg.UdpPortStart + channelKey)
+		ch <- prometheus.MustNewConstMetric(collector.ChannelDepth, prometheus.GaugeValue, float64(len(channel)), app, port)
+		ch <- prometheus.MustNewConstMetric(collector.ChannelCapacity, prometheus.GaugeValue, float64(cap(channel)), app, port)
+	}
+	// Потери в ядре видны только в /proc, без него различить удаётся лишь сброс канала и ошибки разбора
+	socketStats, err := procfs.ReadUdpSocketStats(collector.cfg.ProcRoot)
+	if err != nil {
+		return
+	}
+	for port := collector.cfg.UdpPortStart; port <= collector.cfg.UdpPortEnd; port++ {
+		socketStat, isExist := socketStats[port]
+		if !isExist {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(collector.SocketRxQueue, prometheus.GaugeValue, float64(socketStat.RxQueue), app, strconv.Itoa(port))
+		ch <- prometheus.MustNewConstMetric(collector.TotalSocketDrops, prometheus.CounterValue, float64(socketStat.Drops), app, strconv.Itoa(port))
+	}
+}
+
+func (collector *metricsStruct) collectFpmStatus(ch chan<- prometheus.Metric, app string) {
+	for pool, fpmStatus := range getFpmPoolStatusList() {
+		for field, desc := range collector.FpmPoolGauges {
+			if value, ok := fpmStatus[field].(float64); ok {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, app, pool)
+			}
+		}
+		for field, desc := range collector.FpmPoolCounters {
+			if value, ok := fpmStatus[field].(float64); ok {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, app, pool)
+			}
+		}
+		collector.collectFpmProcesses(ch, app, pool, fpmStatus)
+	}
+}
+
+// collectFpmProcesses агрегирует процессы пула по состоянию: метка pid и сырой uri дали бы ряд на каждый процесс и запрос
+func (collector *metricsStruct) collectFpmProcesses(ch chan<- prometheus.Metric, app string, pool string, fpmStatus map[string]interface{}) {
+	type processRequest struct {
+		state         string
+		requestMethod string
+		requestUri    string
+	}
+	sumByState := make(map[string]map[string]float64)
+	countByRequest := make(map[processRequest]int)
+	processes, _ := fpmStatus["processes"].([]interface{})
+	for _, processValue := range processes {
+		process, ok := processValue.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		state, _ := process["state"].(string)
+		if sumByState[state] == nil {
+			sumByState[state] = make(map[string]float64)
+		}
+		for field := range collector.FpmProcessGauges {
+			if value, ok := process[field].(float64); ok {
+				sumByState[state][field] += value
+			}
+		}
+		requestMethod, _ := process["request method"].(string)
+		requestUri, _ := process["request uri"].(string)
+		if requestUri != "" {
+			requestUri = collector.fpmUriLimiter.Allow(stats.NormalizeUri("", requestUri))
+		}
+		countByRequest[processRequest{state: state, requestMethod: requestMethod, requestUri: requestUri}]++
+	}
+	for state, sumByField := range sumByState {
+		for field, value := range sumByField {
+			ch <- prometheus.MustNewConstMetric(collector.FpmProcessGauges[field], prometheus.GaugeValue, value, app, pool, state)
+		}
+	}
+	for request, count := range countByRequest {
+		ch <- prometheus.MustNewConstMetric(collector.FpmProcesses, prometheus.GaugeValue, float64(count), app, pool, request.state, request.requestMethod, request.requestUri)
+	}
 }
 
 func handlePrometheus(cfg *config.Config) {
 	foo := NewExporter(cfg)
 	prometheus.MustRegister(foo)
+	if queryDuration != nil {
+		prometheus.MustRegister(queryDuration)
+	}
+	if traceErrors != nil {
+		prometheus.MustRegister(traceErrors)
+	}
+	if droppedTraces != nil {
+		prometheus.MustRegister(droppedTraces)
+	}
+	if traceDuration != nil {
+		prometheus.MustRegister(traceDuration)
+	}
+	for _, collector := range pipelineCollectors() {
+		prometheus.MustRegister(collector)
+	}
+	if metricsPusher != nil {
+		go handleMetricsPush(cfg)
+	}
 }
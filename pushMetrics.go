@@ -0,0 +1,71 @@
+package main
+
+import (
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+	"trace-monitor-collector/logger"
+	"trace-monitor-collector/metricsPush"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pushLog       = logger.New("push")
+	metricsPusher *metricsPush.Pusher
+)
+
+type pushCounters struct {
+	Ok     counter.CounterStruct
+	Failed counter.CounterStruct
+}
+
+var metricsPushTotals = map[string]*pushCounters{
+	metricsPush.TargetPushgateway: {},
+	metricsPush.TargetRemoteWrite: {},
+	metricsPush.TargetStatsd:      {},
+}
+
+// handleMetricsPush периодически отправляет метрики, зарегистрированные в handlePrometheus
+func handleMetricsPush(cfg *config.Config) {
+	defer recoverRoutineHandleMetricsPush(cfg)
+
+	ticker := time.NewTicker(cfg.MetricsPush.Interval * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		pushMetrics(prometheus.DefaultGatherer, time.Now())
+	}
+}
+
+func pushMetrics(gatherer prometheus.Gatherer, now time.Time) {
+	// При ошибке сбора часть метрик всё равно получена, отправляем её
+	families, err := gatherer.Gather()
+	if err != nil {
+		pushLog.WarnLimited("gather", "gathering metrics for push", "err", err)
+	}
+	for target, pushErr := range metricsPusher.Push(families, now) {
+		if pushErr != nil {
+			metricsPushTotals[target].Failed.Increment()
+			pushLog.WarnLimited("push-"+target, "pushing metrics", "target", target, "err", pushErr)
+			continue
+		}
+		metricsPushTotals[target].Ok.Increment()
+		pushLog.Debug("metrics pushed", "target", target, "families", len(families))
+	}
+}
+
+func countMetricsPush() map[string]map[string]uint64 {
+	counts := make(map[string]map[string]uint64, len(metricsPushTotals))
+	for target, totals := range metricsPushTotals {
+		counts[target] = map[string]uint64{"ok": totals.Ok.Count(), "failed": totals.Failed.Count()}
+	}
+	return counts
+}
+
+func recoverRoutineHandleMetricsPush(cfg *config.Config) {
+	if r := recover(); r != nil {
+		routinePanics[routineMetricsPush].Increment()
+		pushLog.Error("handle metrics push panic", "panic", r)
+		go handleMetricsPush(cfg)
+	}
+}
@@ -0,0 +1,142 @@
+package redaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+)
+
+var (
+	TotalRedactedByKey     counter.CounterStruct
+	TotalRedactedByPath    counter.CounterStruct
+	TotalRedactedByPattern counter.CounterStruct
+)
+
+// Redactor маскирует чувствительные данные в payload команд.
+// Пути задаются от корня поля data команды через точку, "*" совпадает с любым ключом или индексом массива.
+// Методы безопасно вызывать на nil, тогда данные возвращаются без изменений.
+type Redactor struct {
+	keys     map[string]bool
+	paths    [][]string
+	patterns []*regexp.Regexp
+	mask     string
+}
+
+func New(cfg config.Redaction) (*Redactor, error) {
+	redactor := &Redactor{
+		keys: make(map[string]bool, len(cfg.Keys)),
+		mask: cfg.Mask,
+	}
+	for _, key := range cfg.Keys {
+		redactor.keys[strings.ToLower(key)] = true
+	}
+	for _, path := range cfg.Paths {
+		redactor.paths = append(redactor.paths, strings.Split(path, "."))
+	}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		redactor.patterns = append(redactor.patterns, re)
+	}
+	return redactor, nil
+}
+
+func (r *Redactor) isEmpty() bool {
+	return r == nil || (len(r.keys) == 0 && len(r.paths) == 0 && len(r.patterns) == 0)
+}
+
+// RedactCommand маскирует поле data в сыром JSON команды
+func (r *Redactor) RedactCommand(rawCommand []byte) ([]byte, error) {
+	if r.isEmpty() {
+		return rawCommand, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(rawCommand))
+	decoder.UseNumber()
+	var command map[string]interface{}
+	if err := decoder.Decode(&command); err != nil {
+		return rawCommand, err
+	}
+	if command["data"] == nil {
+		return rawCommand, nil
+	}
+	command["data"] = r.redactValue(command["data"], nil)
+	return json.Marshal(command)
+}
+
+// Redact маскирует уже разобранный payload, path задаёт положение value относительно корня data
+func (r *Redactor) Redact(value interface{}, path ...string) interface{} {
+	if r.isEmpty() {
+		return value
+	}
+	return r.redactValue(value, path)
+}
+
+func (r *Redactor) redactValue(value interface{}, path []string) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			typed[key] = r.redactChild(child, key, path)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			typed[i] = r.redactChild(child, strconv.Itoa(i), path)
+		}
+	case string:
+		return r.redactString(typed)
+	}
+	return value
+}
+
+func (r *Redactor) redactChild(child interface{}, key string, path []string) interface{} {
+	childPath := make([]string, len(path)+1)
+	copy(childPath, path)
+	childPath[len(path)] = key
+	if child == nil {
+		return nil
+	}
+	if r.keys[strings.ToLower(key)] {
+		TotalRedactedByKey.Increment()
+		return r.mask
+	}
+	if r.isPathMatched(childPath) {
+		TotalRedactedByPath.Increment()
+		return r.mask
+	}
+	return r.redactValue(child, childPath)
+}
+
+func (r *Redactor) isPathMatched(path []string) bool {
+	for _, rulePath := range r.paths {
+		if len(rulePath) != len(path) {
+			continue
+		}
+		isMatched := true
+		for i, segment := range rulePath {
+			if segment != "*" && segment != path[i] {
+				isMatched = false
+				break
+			}
+		}
+		if isMatched {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) redactString(value string) string {
+	for _, re := range r.patterns {
+		if re.MatchString(value) {
+			TotalRedactedByPattern.Increment()
+			value = re.ReplaceAllLiteralString(value, r.mask)
+		}
+	}
+	return value
+}
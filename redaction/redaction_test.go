@@ -0,0 +1,85 @@
+package redaction_test
+
+import (
+	"encoding/json"
+	"testing"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/redaction"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedactor(t *testing.T) *redaction.Redactor {
+	redactor, err := redaction.New(config.Redaction{
+		Keys:     []string{"password", "auth_token"},
+		Paths:    []string{"serverContext.body_post", "parentSpans.*.context.bindings"},
+		Patterns: []string{`\b(?:\d[ -]?){13,16}\b`},
+		Mask:     "***",
+	})
+	require.Nil(t, err)
+	return redactor
+}
+
+func TestRedactCommandMasksKeysPathsAndPatterns(t *testing.T) {
+	// Arrange
+	redactor := newRedactor(t)
+	js := []byte(`{"method":"init-trace","pid":"1","traceId":"abc","data":{"serverContext":{"ip":"172.16.101.40","body_post":"card=4111 1111 1111 1111"},"context":{"Password":"qwerty","comment":"paid with 4111111111111111","userId":3824616123456789012},"config":{"password":null}}}`)
+	byKeyBefore := redaction.TotalRedactedByKey.Count()
+	byPathBefore := redaction.TotalRedactedByPath.Count()
+	byPatternBefore := redaction.TotalRedactedByPattern.Count()
+
+	// Act
+	redacted, err := redactor.RedactCommand(js)
+
+	// Assert
+	assert.Nil(t, err)
+	var command struct {
+		Data map[string]map[string]interface{} `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal(redacted, &command))
+	assert.Equal(t, "***", command.Data["serverContext"]["body_post"])
+	assert.Equal(t, "172.16.101.40", command.Data["serverContext"]["ip"])
+	assert.Equal(t, "***", command.Data["context"]["Password"])
+	assert.Equal(t, "paid with ***", command.Data["context"]["comment"])
+	assert.Nil(t, command.Data["config"]["password"])
+	assert.Contains(t, string(redacted), `"userId":3824616123456789012`)
+	assert.Equal(t, byKeyBefore+1, redaction.TotalRedactedByKey.Count())
+	assert.Equal(t, byPathBefore+1, redaction.TotalRedactedByPath.Count())
+	assert.Equal(t, byPatternBefore+1, redaction.TotalRedactedByPattern.Count())
+}
+
+func TestRedactMatchesWildcardPathSegments(t *testing.T) {
+	// Arrange
+	redactor := newRedactor(t)
+	var span map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(`{"span":{"context":{"bindings":[9123]}},"parentSpans":[{"context":{"bindings":["secret"]}},{"context":{"bindings":[1]}}]}`), &span))
+
+	// Act
+	redactor.Redact(span)
+
+	// Assert
+	redacted, _ := json.Marshal(span)
+	assert.JSONEq(t, `{"span":{"context":{"bindings":[9123]}},"parentSpans":[{"context":{"bindings":"***"}},{"context":{"bindings":"***"}}]}`, string(redacted))
+}
+
+func TestRedactReturnsDataUnchangedWhenRedactorIsNil(t *testing.T) {
+	// Arrange
+	var redactor *redaction.Redactor
+	js := []byte(`{"data":{"password":"qwerty"}}`)
+
+	// Act
+	redacted, err := redactor.RedactCommand(js)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, js, redacted)
+}
+
+func TestNewReturnsErrorWhenPatternIsInvalid(t *testing.T) {
+	// Act
+	_, err := redaction.New(config.Redaction{Patterns: []string{"("}})
+
+	// Assert
+	assert.NotNil(t, err)
+}
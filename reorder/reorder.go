@@ -0,0 +1,231 @@
+package reorder
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+	"trace-monitor-collector/command"
+	"trace-monitor-collector/counter"
+)
+
+// Максимум команд, ожидающих в очереди одного pid, при переполнении самые старые отдаются сразу
+const maxPendingPerPid = 1000
+
+var (
+	TotalReordered counter.CounterStruct
+	TotalDuplicate counter.CounterStruct
+	TotalLate      counter.CounterStruct
+)
+
+type ApplyFunc func(channelKey int, cmd command.Command)
+
+type pendingCommand struct {
+	cmd        command.Command
+	channelKey int
+	receivedAt time.Time
+}
+
+type pidQueue struct {
+	// applyMu держится от извлечения команд очереди до их применения, чтобы порядок процесса не нарушился между горутинами.
+	// Очереди разных процессов применяются параллельно
+	applyMu        sync.Mutex
+	pending        []pendingCommand
+	lastReleased   command.Command
+	lastReceivedAt time.Time
+	isReleased     bool
+}
+
+// Buffer задерживает команды каждого pid на время window и отдаёт их отсортированными по sentAt и seq.
+// Так пакеты, пришедшие на разные порты не по порядку, применяются в порядке отправки, а дубли отбрасываются.
+// Пакет старше уже отданных опоздал больше чем на window и тоже отбрасывается.
+type Buffer struct {
+	mu     sync.Mutex
+	window time.Duration
+	queues map[string]*pidQueue
+	apply  ApplyFunc
+}
+
+func New(window time.Duration, apply ApplyFunc) *Buffer {
+	return &Buffer{
+		window: window,
+		queues: make(map[string]*pidQueue),
+		apply:  apply,
+	}
+}
+
+// Один pid может прийти от разных приложений и хостов, очередь у каждого процесса своя
+func queueKey(cmd command.Command) string {
+	return cmd.App + "/" + cmd.Host + "/" + cmd.Pid
+}
+
+func isBefore(left command.Command, right command.Command) bool {
+	if !left.SentAt.Equal(right.SentAt) {
+		return left.SentAt.Before(right.SentAt)
+	}
+	return left.Seq < right.Seq
+}
+
+func isDuplicate(left command.Command, right command.Command) bool {
+	return left.SentAt.Equal(right.SentAt) &&
+		left.Seq == right.Seq &&
+		left.Method == right.Method &&
+		left.TraceId == right.TraceId &&
+		bytes.Equal(left.Data, right.Data)
+}
+
+func (b *Buffer) Push(channelKey int, cmd command.Command) {
+	b.push(channelKey, cmd, time.Now())
+}
+
+// lockQueue возвращает очередь процесса с захваченным applyMu и b.mu.
+// Пока applyMu ждал, Flush мог удалить очередь из карты, тогда берётся новая
+func (b *Buffer) lockQueue(key string) *pidQueue {
+	for {
+		b.mu.Lock()
+		queue, isExist := b.queues[key]
+		if !isExist {
+			queue = new(pidQueue)
+			b.queues[key] = queue
+		}
+		b.mu.Unlock()
+
+		queue.applyMu.Lock()
+		b.mu.Lock()
+		if b.queues[key] == queue {
+			return queue
+		}
+		b.mu.Unlock()
+		queue.applyMu.Unlock()
+	}
+}
+
+func (b *Buffer) push(channelKey int, cmd command.Command, receivedAt time.Time) {
+	var overflow []pendingCommand
+
+	queue := b.lockQueue(queueKey(cmd))
+	defer queue.applyMu.Unlock()
+	if queue.isReleased && isDuplicate(queue.lastReleased, cmd) {
+		b.mu.Unlock()
+		TotalDuplicate.Increment()
+		return
+	}
+	if queue.isReleased && isBefore(cmd, queue.lastReleased) {
+		b.mu.Unlock()
+		TotalLate.Increment()
+		return
+	}
+	position := sort.Search(len(queue.pending), func(i int) bool {
+		return isBefore(cmd, queue.pending[i].cmd)
+	})
+	if position > 0 && isDuplicate(queue.pending[position-1].cmd, cmd) {
+		b.mu.Unlock()
+		TotalDuplicate.Increment()
+		return
+	}
+	if position < len(queue.pending) {
+		TotalReordered.Increment()
+	}
+	queue.pending = append(queue.pending, pendingCommand{})
+	copy(queue.pending[position+1:], queue.pending[position:])
+	queue.pending[position] = pendingCommand{cmd: cmd, channelKey: channelKey, receivedAt: receivedAt}
+	if len(queue.pending) > maxPendingPerPid {
+		overflow = b.release(queue, len(queue.pending)-maxPendingPerPid)
+	}
+	b.mu.Unlock()
+
+	b.applyAll(overflow)
+}
+
+// release забирает первые count команд очереди, вызывается под мьютексом
+func (b *Buffer) release(queue *pidQueue, count int) []pendingCommand {
+	released := make([]pendingCommand, count)
+	copy(released, queue.pending[:count])
+	queue.pending = append(queue.pending[:0], queue.pending[count:]...)
+	queue.lastReleased = released[count-1].cmd
+	queue.lastReceivedAt = released[count-1].receivedAt
+	queue.isReleased = true
+	return released
+}
+
+func (b *Buffer) applyAll(pendingList []pendingCommand) {
+	for _, pending := range pendingList {
+		b.apply(pending.channelKey, pending.cmd)
+	}
+}
+
+// Flush отдаёт все команды, которые пролежали в буфере дольше window.
+// Команду нельзя отдать раньше предшествующих ей по sentAt, поэтому берётся префикс до последней просроченной.
+func (b *Buffer) Flush(now time.Time) {
+	b.mu.Lock()
+	keys := make([]string, 0, len(b.queues))
+	for key := range b.queues {
+		keys = append(keys, key)
+	}
+	b.mu.Unlock()
+
+	for _, key := range keys {
+		b.flushQueue(key, now)
+	}
+}
+
+func (b *Buffer) flushQueue(key string, now time.Time) {
+	var ready []pendingCommand
+
+	b.mu.Lock()
+	queue, isExist := b.queues[key]
+	b.mu.Unlock()
+	if !isExist {
+		return
+	}
+	queue.applyMu.Lock()
+	defer queue.applyMu.Unlock()
+	b.mu.Lock()
+	if b.queues[key] != queue {
+		b.mu.Unlock()
+		return
+	}
+	lastExpired := -1
+	for i, pending := range queue.pending {
+		if now.Sub(pending.receivedAt) >= b.window {
+			lastExpired = i
+		}
+	}
+	if lastExpired >= 0 {
+		ready = b.release(queue, lastExpired+1)
+	} else if len(queue.pending) == 0 && now.Sub(queue.lastReceivedAt) > time.Minute {
+		delete(b.queues, key)
+	}
+	b.mu.Unlock()
+
+	b.applyAll(ready)
+}
+
+func (b *Buffer) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var count int
+	for _, queue := range b.queues {
+		count += len(queue.pending)
+	}
+	return count
+}
+
+func (b *Buffer) Run(ctx context.Context) {
+	interval := b.window / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.Flush(time.Now().Add(b.window))
+			return
+		case now := <-ticker.C:
+			b.Flush(now)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package reorder_test
+
+import (
+	"testing"
+	"time"
+	"trace-monitor-collector/command"
+	"trace-monitor-collector/reorder"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectApplied(applied *[]command.Command) reorder.ApplyFunc {
+	return func(channelKey int, cmd command.Command) {
+		*applied = append(*applied, cmd)
+	}
+}
+
+func TestFlushAppliesCommandsSortedBySentAtAndSeq(t *testing.T) {
+	// Arrange
+	var applied []command.Command
+	buffer := reorder.New(time.Hour, collectApplied(&applied))
+	sentAt := time.Date(2023, 4, 10, 14, 4, 31, 0, time.UTC)
+	reorderedBefore := reorder.TotalReordered.Count()
+
+	// Act
+	buffer.Push(0, command.Command{Pid: "1", Method: "set-trace-current-span", SentAt: sentAt.Add(2 * time.Millisecond)})
+	buffer.Push(1, command.Command{Pid: "1", Method: "init-trace", SentAt: sentAt})
+	buffer.Push(0, command.Command{Pid: "1", Method: "free-pid", SentAt: sentAt.Add(2 * time.Millisecond), Seq: 2})
+	buffer.Push(1, command.Command{Pid: "1", Method: "set-trace-current-span", SentAt: sentAt.Add(2 * time.Millisecond), Seq: 1})
+	buffer.Flush(time.Now())
+	appliedBeforeWindow := len(applied)
+	buffer.Flush(time.Now().Add(time.Hour))
+
+	// Assert
+	assert.Equal(t, 0, appliedBeforeWindow)
+	assert.Len(t, applied, 4)
+	assert.Equal(t, "init-trace", applied[0].Method)
+	assert.Equal(t, uint64(0), applied[1].Seq)
+	assert.Equal(t, uint64(1), applied[2].Seq)
+	assert.Equal(t, "free-pid", applied[3].Method)
+	assert.Equal(t, reorderedBefore+2, reorder.TotalReordered.Count())
+	assert.Equal(t, 0, buffer.Pending())
+}
+
+func TestPushDropsDuplicates(t *testing.T) {
+	// Arrange
+	var applied []command.Command
+	buffer := reorder.New(time.Hour, collectApplied(&applied))
+	cmd := command.Command{Pid: "2", Method: "init-trace", TraceId: "abc", SentAt: time.Now(), Seq: 7, Data: []byte(`{}`)}
+	duplicateBefore := reorder.TotalDuplicate.Count()
+
+	// Act
+	buffer.Push(0, cmd)
+	buffer.Push(1, cmd)
+	buffer.Flush(time.Now().Add(time.Hour))
+	buffer.Push(0, cmd)
+	buffer.Flush(time.Now().Add(time.Hour))
+
+	// Assert
+	assert.Len(t, applied, 1)
+	assert.Equal(t, duplicateBefore+2, reorder.TotalDuplicate.Count())
+}
+
+func TestPushDropsPacketsArrivingAfterNewerWereReleased(t *testing.T) {
+	// Arrange
+	var applied []command.Command
+	buffer := reorder.New(time.Hour, collectApplied(&applied))
+	sentAt := time.Now()
+	lateBefore := reorder.TotalLate.Count()
+
+	// Act
+	buffer.Push(0, command.Command{Pid: "3", Method: "free-pid", SentAt: sentAt})
+	buffer.Flush(time.Now().Add(time.Hour))
+	buffer.Push(0, command.Command{Pid: "3", Method: "init-trace", SentAt: sentAt.Add(-time.Millisecond)})
+	buffer.Flush(time.Now().Add(time.Hour))
+
+	// Assert
+	assert.Equal(t, lateBefore+1, reorder.TotalLate.Count())
+	assert.Len(t, applied, 1)
+	assert.Equal(t, "free-pid", applied[0].Method)
+	assert.Equal(t, 0, buffer.Pending())
+}
+
+func TestPushIsNotBlockedByApplyOfAnotherProcess(t *testing.T) {
+	// Arrange
+	applyStarted := make(chan struct{})
+	applyRelease := make(chan struct{})
+	buffer := reorder.New(0, func(channelKey int, cmd command.Command) {
+		if cmd.Pid == "10" {
+			close(applyStarted)
+			<-applyRelease
+		}
+	})
+	defer close(applyRelease)
+	buffer.Push(0, command.Command{Pid: "10", Method: "init-trace", SentAt: time.Now()})
+	go buffer.Flush(time.Now())
+	<-applyStarted
+	pushed := make(chan struct{})
+
+	// Act
+	go func() {
+		buffer.Push(0, command.Command{Pid: "11", Method: "init-trace", SentAt: time.Now()})
+		close(pushed)
+	}()
+
+	// Assert
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push of another process waited for apply")
+	}
+}
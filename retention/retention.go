@@ -0,0 +1,199 @@
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sync"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+	"trace-monitor-collector/tagFilter"
+	"trace-monitor-collector/traceCollection"
+)
+
+// Правило головного сэмплирования, по которому трейс сохраняется без совпадения хвостовых правил
+const RuleHead = "head"
+
+type headRule struct {
+	hasApp   bool
+	app      string
+	tagKey   string
+	tagValue string
+	percent  float64
+}
+
+type tailRule struct {
+	name        string
+	minDuration time.Duration
+	hasError    bool
+	spanName    *regexp.Regexp
+}
+
+// Policy решает, какие завершённые трейсы сохранять.
+// Хвостовые правила проверяются по порядку, первое совпавшее сохраняет трейс.
+// Иначе трейс сохраняется с вероятностью головного сэмплирования, решение детерминировано по traceId.
+type Policy struct {
+	headPercent float64
+	headRules   []headRule
+	tailRules   []tailRule
+
+	mu      sync.Mutex
+	kept    map[string]*counter.CounterStruct
+	dropped map[string]*counter.CounterStruct
+}
+
+// NewPolicy собирает правила из cfg. appName — приложение коллектора: его трейсы приходят без app,
+// поэтому головное правило с этим приложением сравнивается с пустым app
+func NewPolicy(cfg config.Retention, appName string) (*Policy, error) {
+	policy := &Policy{
+		headPercent: cfg.HeadSamplePercent,
+		kept:        make(map[string]*counter.CounterStruct),
+		dropped:     make(map[string]*counter.CounterStruct),
+	}
+	for _, rule := range cfg.HeadSampling {
+		tagKey, tagValue := tagFilter.Parse(rule.Tag)
+		app := rule.App
+		if app == appName {
+			app = ""
+		}
+		policy.headRules = append(policy.headRules, headRule{
+			hasApp:   rule.App != "",
+			app:      app,
+			tagKey:   tagKey,
+			tagValue: tagValue,
+			percent:  rule.Percent,
+		})
+	}
+	for i, rule := range cfg.TailRules {
+		compiled := tailRule{
+			name:        rule.Name,
+			minDuration: time.Duration(rule.MinDurationMs) * time.Millisecond,
+			hasError:    rule.HasError,
+		}
+		if compiled.name == "" {
+			compiled.name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.SpanName != "" {
+			spanName, err := regexp.Compile(rule.SpanName)
+			if err != nil {
+				return nil, fmt.Errorf("invalid span_name in retention rule %s. %v", compiled.name, err)
+			}
+			compiled.spanName = spanName
+		}
+		if compiled.minDuration == 0 && !compiled.hasError && compiled.spanName == nil {
+			return nil, fmt.Errorf("retention rule %s has no conditions", compiled.name)
+		}
+		policy.tailRules = append(policy.tailRules, compiled)
+	}
+	return policy, nil
+}
+
+func (r tailRule) isMatched(trace traceCollection.ClosedTrace) bool {
+	if r.minDuration > 0 && trace.Duration < r.minDuration {
+		return false
+	}
+	if r.hasError && len(trace.Errors) == 0 {
+		return false
+	}
+	if r.spanName != nil {
+		isSpanMatched := false
+		for _, spanName := range trace.SpanNames {
+			if r.spanName.MatchString(spanName) {
+				isSpanMatched = true
+				break
+			}
+		}
+		if !isSpanMatched {
+			return false
+		}
+	}
+	return true
+}
+
+func (r headRule) isMatched(trace traceCollection.ClosedTrace, tags map[string]interface{}) bool {
+	if r.hasApp && r.app != trace.App {
+		return false
+	}
+	if r.tagKey != "" {
+		value, isExist := tags[r.tagKey]
+		if !isExist {
+			return false
+		}
+		if r.tagValue != "" && fmt.Sprint(value) != r.tagValue {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) headPercentFor(trace traceCollection.ClosedTrace) float64 {
+	if len(p.headRules) == 0 {
+		return p.headPercent
+	}
+	var tags map[string]interface{}
+	if trace.Tags != nil {
+		json.Unmarshal(trace.Tags, &tags)
+	}
+	for _, rule := range p.headRules {
+		if rule.isMatched(trace, tags) {
+			return rule.percent
+		}
+	}
+	return p.headPercent
+}
+
+func isSampled(traceId string, percent float64) bool {
+	if percent <= 0 {
+		return false
+	}
+	if percent >= 100 {
+		return true
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(traceId))
+	return float64(hash.Sum32()%10000) < percent*100
+}
+
+// Decide возвращает, сохранять ли трейс, и правило, по которому принято решение
+func (p *Policy) Decide(trace traceCollection.ClosedTrace) (bool, string) {
+	for _, rule := range p.tailRules {
+		if rule.isMatched(trace) {
+			p.count(p.kept, rule.name)
+			return true, rule.name
+		}
+	}
+	if isSampled(trace.TraceId, p.headPercentFor(trace)) {
+		p.count(p.kept, RuleHead)
+		return true, RuleHead
+	}
+	p.count(p.dropped, RuleHead)
+	return false, RuleHead
+}
+
+func (p *Policy) count(counters map[string]*counter.CounterStruct, rule string) {
+	p.mu.Lock()
+	ruleCounter, isExist := counters[rule]
+	if !isExist {
+		ruleCounter = new(counter.CounterStruct)
+		counters[rule] = ruleCounter
+	}
+	p.mu.Unlock()
+	ruleCounter.Increment()
+}
+
+// CountByRule возвращает число сохранённых и отброшенных трейсов по правилам
+func (p *Policy) CountByRule() (map[string]uint64, map[string]uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	kept := make(map[string]uint64, len(p.kept))
+	for rule, ruleCounter := range p.kept {
+		kept[rule] = ruleCounter.Count()
+	}
+	dropped := make(map[string]uint64, len(p.dropped))
+	for rule, ruleCounter := range p.dropped {
+		dropped[rule] = ruleCounter.Count()
+	}
+	return kept, dropped
+}
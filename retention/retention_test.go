@@ -0,0 +1,107 @@
+package retention_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/retention"
+	"trace-monitor-collector/traceCollection"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecideKeepsByFirstMatchedTailRule(t *testing.T) {
+	// Arrange
+	policy, err := retention.NewPolicy(config.Retention{
+		Keep: 10,
+		TailRules: []config.TailRule{
+			{Name: "slow", MinDurationMs: 1000},
+			{Name: "errors", HasError: true},
+			{Name: "db", SpanName: "^Database"},
+		},
+	}, "")
+	require.Nil(t, err)
+	slowTrace := traceCollection.ClosedTrace{TraceId: "1", Duration: 2 * time.Second}
+	failedTrace := traceCollection.ClosedTrace{TraceId: "2", Errors: []traceCollection.TraceError{{Class: "RuntimeException"}}}
+	dbTrace := traceCollection.ClosedTrace{TraceId: "3", SpanNames: []string{"Redis command", "Database query"}}
+	fastTrace := traceCollection.ClosedTrace{TraceId: "4", Duration: time.Millisecond}
+
+	// Act
+	isSlowKept, slowRule := policy.Decide(slowTrace)
+	isFailedKept, failedRule := policy.Decide(failedTrace)
+	isDbKept, dbRule := policy.Decide(dbTrace)
+	isFastKept, fastRule := policy.Decide(fastTrace)
+
+	// Assert
+	assert.True(t, isSlowKept)
+	assert.Equal(t, "slow", slowRule)
+	assert.True(t, isFailedKept)
+	assert.Equal(t, "errors", failedRule)
+	assert.True(t, isDbKept)
+	assert.Equal(t, "db", dbRule)
+	assert.False(t, isFastKept)
+	assert.Equal(t, retention.RuleHead, fastRule)
+	kept, dropped := policy.CountByRule()
+	assert.Equal(t, map[string]uint64{"slow": 1, "errors": 1, "db": 1}, kept)
+	assert.Equal(t, map[string]uint64{retention.RuleHead: 1}, dropped)
+}
+
+func TestDecideSamplesHeadByAppAndTag(t *testing.T) {
+	// Arrange
+	policy, err := retention.NewPolicy(config.Retention{
+		Keep:              10,
+		HeadSamplePercent: 0,
+		HeadSampling: []config.HeadSampleRule{
+			{Tag: "userId=42", Percent: 100},
+			{App: "billing", Percent: 50},
+			{App: "app-name", Percent: 100},
+		},
+	}, "app-name")
+	require.Nil(t, err)
+	keptBilling := 0
+
+	// Act
+	isTaggedKept, _ := policy.Decide(traceCollection.ClosedTrace{TraceId: "a", Tags: json.RawMessage(`{"userId":42}`)})
+	isOtherKept, _ := policy.Decide(traceCollection.ClosedTrace{TraceId: "b", App: "api"})
+	isOwnAppKept, _ := policy.Decide(traceCollection.ClosedTrace{TraceId: "c"})
+	for i := 0; i < 1000; i++ {
+		if isKept, _ := policy.Decide(traceCollection.ClosedTrace{TraceId: fmt.Sprint("billing-", i), App: "billing"}); isKept {
+			keptBilling++
+		}
+	}
+
+	// Assert
+	assert.True(t, isTaggedKept)
+	assert.False(t, isOtherKept)
+	assert.True(t, isOwnAppKept)
+	assert.InDelta(t, 500, keptBilling, 100)
+}
+
+func TestNewPolicyRejectsRuleWithoutConditions(t *testing.T) {
+	// Act
+	_, err := retention.NewPolicy(config.Retention{TailRules: []config.TailRule{{Name: "empty"}}}, "")
+
+	// Assert
+	assert.NotNil(t, err)
+}
+
+func TestStoreFindsRetainedTraceAndForgetsOverwritten(t *testing.T) {
+	// Arrange
+	store := retention.NewStore(2)
+
+	// Act
+	store.Add(retention.Trace{TraceId: "1"})
+	store.Add(retention.Trace{TraceId: "2"})
+	store.Add(retention.Trace{TraceId: "3"})
+
+	// Assert
+	_, isFirstExist := store.Get("1")
+	third, isThirdExist := store.Get("3")
+	assert.False(t, isFirstExist)
+	assert.True(t, isThirdExist)
+	assert.Equal(t, "3", third.TraceId)
+	assert.Equal(t, 2, store.Len())
+}
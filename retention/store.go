@@ -0,0 +1,101 @@
+package retention
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+	"trace-monitor-collector/traceCollection"
+)
+
+type Trace struct {
+	App        string                       `json:"app,omitempty"`
+	Host       string                       `json:"host,omitempty"`
+	Pid        string                       `json:"pid"`
+	TraceId    string                       `json:"traceId"`
+	Method     string                       `json:"method,omitempty"`
+	Uri        string                       `json:"uri,omitempty"`
+	DurationMs int64                        `json:"durationMs"`
+	ClosedAt   time.Time                    `json:"closedAt"`
+	Rule       string                       `json:"rule"`
+	SpanNames  []string                     `json:"spanNames,omitempty"`
+	Errors     []traceCollection.TraceError `json:"errors,omitempty"`
+	Events     []json.RawMessage            `json:"events,omitempty"`
+	Tags       json.RawMessage              `json:"tags,omitempty"`
+	Context    json.RawMessage              `json:"context,omitempty"`
+	Trace      json.RawMessage              `json:"trace,omitempty"`
+}
+
+// Store хранит последние size сохранённых трейсов с поиском по traceId
+type Store struct {
+	mu        sync.Mutex
+	traces    []Trace
+	byTraceId map[string]int
+	next      int
+	size      int
+}
+
+func NewStore(size int) *Store {
+	return &Store{
+		traces:    make([]Trace, 0, size),
+		byTraceId: make(map[string]int, size),
+		size:      size,
+	}
+}
+
+func NewTrace(trace traceCollection.ClosedTrace, rule string) Trace {
+	retained := Trace{
+		App:        trace.App,
+		Host:       trace.Host,
+		Pid:        trace.Pid,
+		TraceId:    trace.TraceId,
+		Method:     trace.Method,
+		Uri:        trace.Uri,
+		DurationMs: trace.Duration.Milliseconds(),
+		ClosedAt:   trace.ClosedAt,
+		Rule:       rule,
+		SpanNames:  trace.SpanNames,
+		Errors:     trace.Errors,
+		Tags:       trace.Tags,
+		Context:    trace.Context,
+		Trace:      trace.Trace,
+	}
+	for _, event := range trace.Events {
+		retained.Events = append(retained.Events, event)
+	}
+	return retained
+}
+
+func (s *Store) Add(trace Trace) {
+	if s.size <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.traces) < s.size {
+		s.byTraceId[trace.TraceId] = len(s.traces)
+		s.traces = append(s.traces, trace)
+		return
+	}
+	if s.byTraceId[s.traces[s.next].TraceId] == s.next {
+		delete(s.byTraceId, s.traces[s.next].TraceId)
+	}
+	s.traces[s.next] = trace
+	s.byTraceId[trace.TraceId] = s.next
+	s.next = (s.next + 1) % s.size
+}
+
+func (s *Store) Get(traceId string) (Trace, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, isExist := s.byTraceId[traceId]
+	if !isExist {
+		return Trace{}, false
+	}
+	return s.traces[index], true
+}
+
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.traces)
+}
@@ -0,0 +1,106 @@
+package skew
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"trace-monitor-collector/counter"
+)
+
+const (
+	// Максимум отслеживаемых источников, новые сверх лимита не учитываются
+	maxSources = 1000
+	// Источник без пакетов дольше этого времени забывается
+	staleAfter = 10 * time.Minute
+	// Вес нового замера в скользящем среднем
+	smoothing = 0.1
+)
+
+var (
+	TotalSkewWarnings counter.CounterStruct
+)
+
+type sourceState struct {
+	offset     float64
+	lastSeenAt time.Time
+	isExceeded bool
+}
+
+type SourceSkew struct {
+	Source     string
+	Offset     time.Duration
+	IsExceeded bool
+}
+
+// Tracker оценивает расхождение часов клиентов и коллектора по разнице между временем получения пакета и его sentAt.
+// В оценку входит и сетевая задержка, но для UDP в пределах одной площадки она пренебрежимо мала.
+type Tracker struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	sources   map[string]*sourceState
+}
+
+func New(threshold time.Duration) *Tracker {
+	return &Tracker{
+		threshold: threshold,
+		sources:   make(map[string]*sourceState),
+	}
+}
+
+// Observe учитывает пакет и возвращает текущую оценку расхождения для источника.
+// isChanged сообщает, что источник только что перешёл порог в любую сторону.
+func (t *Tracker) Observe(source string, sentAt time.Time, receivedAt time.Time) (offset time.Duration, isExceeded bool, isChanged bool) {
+	if sentAt.IsZero() || receivedAt.IsZero() {
+		return 0, false, false
+	}
+	sample := float64(receivedAt.Sub(sentAt))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, isExist := t.sources[source]
+	if !isExist {
+		if len(t.sources) >= maxSources {
+			return 0, false, false
+		}
+		state = &sourceState{offset: sample}
+		t.sources[source] = state
+	} else {
+		state.offset += smoothing * (sample - state.offset)
+	}
+	state.lastSeenAt = receivedAt
+
+	offset = time.Duration(state.offset)
+	isExceeded = t.threshold > 0 && (offset > t.threshold || offset < -t.threshold)
+	if isExceeded != state.isExceeded {
+		state.isExceeded = isExceeded
+		isChanged = true
+		if isExceeded {
+			TotalSkewWarnings.Increment()
+		}
+	}
+
+	return offset, isExceeded, isChanged
+}
+
+// Snapshot возвращает оценки по всем источникам, попутно забывая давно молчащие
+func (t *Tracker) Snapshot(now time.Time) []SourceSkew {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]SourceSkew, 0, len(t.sources))
+	for source, state := range t.sources {
+		if now.Sub(state.lastSeenAt) > staleAfter {
+			delete(t.sources, source)
+			continue
+		}
+		result = append(result, SourceSkew{
+			Source:     source,
+			Offset:     time.Duration(state.offset),
+			IsExceeded: state.isExceeded,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Source < result[j].Source
+	})
+
+	return result
+}
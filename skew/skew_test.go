@@ -0,0 +1,45 @@
+package skew_test
+
+import (
+	"testing"
+	"time"
+	"trace-monitor-collector/skew"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveReportsThresholdCrossingOnce(t *testing.T) {
+	// Arrange
+	tracker := skew.New(time.Second)
+	now := time.Now()
+	tracker.Observe("10.0.0.1", now.Add(-10*time.Millisecond), now)
+	warningsBefore := skew.TotalSkewWarnings.Count()
+
+	// Act
+	_, _, isFirstChanged := tracker.Observe("10.0.0.2", now.Add(-5*time.Second), now)
+	offset, isExceeded, isSecondChanged := tracker.Observe("10.0.0.2", now.Add(-5*time.Second), now)
+
+	// Assert
+	assert.True(t, isFirstChanged)
+	assert.False(t, isSecondChanged)
+	assert.True(t, isExceeded)
+	assert.Equal(t, 5*time.Second, offset)
+	assert.Equal(t, warningsBefore+1, skew.TotalSkewWarnings.Count())
+}
+
+func TestSnapshotForgetsStaleSources(t *testing.T) {
+	// Arrange
+	tracker := skew.New(time.Second)
+	now := time.Now()
+	tracker.Observe("10.0.0.1", now.Add(-time.Hour-10*time.Millisecond), now.Add(-time.Hour))
+	tracker.Observe("10.0.0.2", now.Add(-10*time.Millisecond), now)
+
+	// Act
+	sources := tracker.Snapshot(now)
+
+	// Assert
+	assert.Len(t, sources, 1)
+	assert.Equal(t, "10.0.0.2", sources[0].Source)
+	assert.Equal(t, 10*time.Millisecond, sources[0].Offset)
+	assert.False(t, sources[0].IsExceeded)
+}
@@ -0,0 +1,204 @@
+package stats
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	bucketDuration   = 15 * time.Second
+	bucketCount      = int(15 * time.Minute / bucketDuration)
+	samplesPerBucket = 32
+	OverflowKey      = "__other__"
+	DefaultWindow    = 5 * time.Minute
+	DefaultTopLimit  = 10
+	DefaultMaxKeys   = 1000
+	SortByCount      = "count"
+	SortByP50        = "p50"
+	SortByP95        = "p95"
+	SortByP99        = "p99"
+	SortByMax        = "max"
+	SortByTotal      = "total"
+)
+
+var Windows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+var (
+	Spans   *Aggregator
+	Uris    *Aggregator
+	Queries *Aggregator
+)
+
+type bucket struct {
+	index   int64
+	count   uint64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration
+}
+
+type series struct {
+	buckets [bucketCount]bucket
+}
+
+// Aggregator хранит скользящие окна длительностей по ключу (имя спана, uri) с ограничением числа ключей.
+// Перцентили считаются по выборке из каждого 15-секундного бакета, поэтому приблизительные.
+type Aggregator struct {
+	mu      sync.Mutex
+	series  map[string]*series
+	maxKeys int
+	rnd     *rand.Rand
+}
+
+type Stat struct {
+	Name    string  `json:"name"`
+	Count   uint64  `json:"count"`
+	TotalMs float64 `json:"totalMs"`
+	P50Ms   float64 `json:"p50Ms"`
+	P95Ms   float64 `json:"p95Ms"`
+	P99Ms   float64 `json:"p99Ms"`
+	MaxMs   float64 `json:"maxMs"`
+}
+
+func NewAggregator(maxKeys int) *Aggregator {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &Aggregator{
+		series:  make(map[string]*series),
+		maxKeys: maxKeys,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (a *Aggregator) Observe(key string, duration time.Duration, at time.Time) {
+	if a == nil || duration < 0 {
+		return
+	}
+	index := at.UnixNano() / int64(bucketDuration)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keySeries, isExist := a.series[key]
+	if !isExist {
+		if len(a.series) >= a.maxKeys {
+			key = OverflowKey
+			keySeries, isExist = a.series[key]
+		}
+		if !isExist {
+			keySeries = new(series)
+			a.series[key] = keySeries
+		}
+	}
+	b := &keySeries.buckets[index%int64(bucketCount)]
+	if b.index != index {
+		*b = bucket{index: index, samples: b.samples[:0]}
+	}
+	b.count++
+	b.total += duration
+	if duration > b.max {
+		b.max = duration
+	}
+	if len(b.samples) < samplesPerBucket {
+		b.samples = append(b.samples, duration)
+	} else if position := a.rnd.Int63n(int64(b.count)); position < samplesPerBucket {
+		b.samples[position] = duration
+	}
+}
+
+// Top возвращает limit ключей за окно window, отсортированных по убыванию поля sortBy
+func (a *Aggregator) Top(window time.Duration, sortBy string, limit int, now time.Time) []Stat {
+	if a == nil {
+		return []Stat{}
+	}
+	minIndex := (now.UnixNano() - int64(window)) / int64(bucketDuration)
+	maxIndex := now.UnixNano() / int64(bucketDuration)
+
+	a.mu.Lock()
+	statList := make([]Stat, 0, len(a.series))
+	var samples []time.Duration
+	for key, keySeries := range a.series {
+		stat := Stat{Name: key}
+		var total, max time.Duration
+		samples = samples[:0]
+		for i := range keySeries.buckets {
+			b := &keySeries.buckets[i]
+			if b.count == 0 || b.index <= minIndex || b.index > maxIndex {
+				continue
+			}
+			stat.Count += b.count
+			total += b.total
+			if b.max > max {
+				max = b.max
+			}
+			samples = append(samples, b.samples...)
+		}
+		if stat.Count == 0 {
+			continue
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		stat.TotalMs = toMs(total)
+		stat.MaxMs = toMs(max)
+		stat.P50Ms = toMs(percentile(samples, 0.50))
+		stat.P95Ms = toMs(percentile(samples, 0.95))
+		stat.P99Ms = toMs(percentile(samples, 0.99))
+		statList = append(statList, stat)
+	}
+	a.mu.Unlock()
+
+	sort.Slice(statList, func(i, j int) bool {
+		left, right := sortValue(statList[i], sortBy), sortValue(statList[j], sortBy)
+		if left == right {
+			return statList[i].Name < statList[j].Name
+		}
+		return left > right
+	})
+	if limit > 0 && len(statList) > limit {
+		statList = statList[:limit]
+	}
+	return statList
+}
+
+func IsValidSortBy(sortBy string) bool {
+	switch sortBy {
+	case SortByCount, SortByP50, SortByP95, SortByP99, SortByMax, SortByTotal:
+		return true
+	}
+	return false
+}
+
+func sortValue(stat Stat, sortBy string) float64 {
+	switch sortBy {
+	case SortByCount:
+		return float64(stat.Count)
+	case SortByP50:
+		return stat.P50Ms
+	case SortByP99:
+		return stat.P99Ms
+	case SortByMax:
+		return stat.MaxMs
+	case SortByTotal:
+		return stat.TotalMs
+	}
+	return stat.P95Ms
+}
+
+func percentile(sorted []time.Duration, quantile float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(quantile*float64(len(sorted))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func toMs(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
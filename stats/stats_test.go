@@ -0,0 +1,77 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+	"trace-monitor-collector/stats"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopCalculatesPercentilesAndSortsByField(t *testing.T) {
+	// Arrange
+	aggregator := stats.NewAggregator(10)
+	now := time.Now()
+	for i := 1; i <= 20; i++ {
+		aggregator.Observe("Database query", time.Duration(i)*time.Millisecond, now)
+	}
+	aggregator.Observe("Redis command", 500*time.Millisecond, now)
+
+	// Act
+	byP95 := aggregator.Top(time.Minute, stats.SortByP95, 10, now)
+	byCount := aggregator.Top(time.Minute, stats.SortByCount, 1, now)
+
+	// Assert
+	require.Len(t, byP95, 2)
+	assert.Equal(t, "Redis command", byP95[0].Name)
+	assert.Equal(t, "Database query", byP95[1].Name)
+	assert.Equal(t, uint64(20), byP95[1].Count)
+	assert.Equal(t, 10.0, byP95[1].P50Ms)
+	assert.Equal(t, 19.0, byP95[1].P95Ms)
+	assert.Equal(t, 20.0, byP95[1].P99Ms)
+	assert.Equal(t, 20.0, byP95[1].MaxMs)
+	require.Len(t, byCount, 1)
+	assert.Equal(t, "Database query", byCount[0].Name)
+}
+
+func TestTopIgnoresObservationsOutsideWindow(t *testing.T) {
+	// Arrange
+	aggregator := stats.NewAggregator(10)
+	now := time.Now()
+	aggregator.Observe("old", time.Second, now.Add(-10*time.Minute))
+	aggregator.Observe("recent", time.Second, now.Add(-30*time.Second))
+
+	// Act
+	lastMinute := aggregator.Top(time.Minute, stats.SortByCount, 10, now)
+	last15Minutes := aggregator.Top(15*time.Minute, stats.SortByCount, 10, now)
+
+	// Assert
+	require.Len(t, lastMinute, 1)
+	assert.Equal(t, "recent", lastMinute[0].Name)
+	assert.Len(t, last15Minutes, 2)
+}
+
+func TestObserveGroupsKeysOverLimitIntoOverflow(t *testing.T) {
+	// Arrange
+	aggregator := stats.NewAggregator(2)
+	now := time.Now()
+
+	// Act
+	aggregator.Observe("a", time.Millisecond, now)
+	aggregator.Observe("b", time.Millisecond, now)
+	aggregator.Observe("c", time.Millisecond, now)
+	aggregator.Observe("d", time.Millisecond, now)
+
+	// Assert
+	top := aggregator.Top(time.Minute, stats.SortByCount, 10, now)
+	require.Len(t, top, 3)
+	assert.Equal(t, stats.OverflowKey, top[0].Name)
+	assert.Equal(t, uint64(2), top[0].Count)
+}
+
+func TestNormalizeUriReplacesIdsAndStripsQuery(t *testing.T) {
+	assert.Equal(t, "GET /v3.0/car-address", stats.NormalizeUri("GET", "/v3.0/car-address?car_id=9123"))
+	assert.Equal(t, "POST /users/{id}/devices/{id}", stats.NormalizeUri("POST", "/users/3824616/devices/A7526423-BD21-4DA1-9954-C172ACEB96DB"))
+	assert.Equal(t, "/health", stats.NormalizeUri("", "/health"))
+}
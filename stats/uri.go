@@ -0,0 +1,24 @@
+package stats
+
+import (
+	"regexp"
+	"strings"
+)
+
+var uriIdSegmentRegexp = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// NormalizeUri убирает query string и заменяет идентификаторы в пути на {id}, чтобы ограничить число ключей
+func NormalizeUri(method string, uri string) string {
+	path := strings.SplitN(uri, "?", 2)[0]
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if uriIdSegmentRegexp.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	path = strings.Join(segments, "/")
+	if method == "" {
+		return path
+	}
+	return method + " " + path
+}
@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+	"trace-monitor-collector/counter"
+)
+
+const (
+	EventInitTrace = "init-trace"
+	EventSpanSet   = "span-set"
+	EventSpanClose = "span-close"
+	EventFreePid   = "free-pid"
+)
+
+type Event struct {
+	Type     string                 `json:"type"`
+	App      string                 `json:"app,omitempty"`
+	Host     string                 `json:"host,omitempty"`
+	Pid      string                 `json:"pid"`
+	TraceId  string                 `json:"traceId"`
+	SentAt   time.Time              `json:"sentAt"`
+	SpanName string                 `json:"spanName,omitempty"`
+	Tags     map[string]interface{} `json:"tags,omitempty"`
+	Data     json.RawMessage        `json:"data,omitempty"`
+}
+
+type Filter struct {
+	App      string
+	Pid      string
+	TraceId  string
+	SpanName string
+	TagKey   string
+	TagValue string
+}
+
+func (f Filter) IsMatched(event Event) bool {
+	if f.App != "" && f.App != event.App {
+		return false
+	}
+	if f.Pid != "" && f.Pid != event.Pid {
+		return false
+	}
+	if f.TraceId != "" && f.TraceId != event.TraceId {
+		return false
+	}
+	if f.SpanName != "" && f.SpanName != event.SpanName {
+		return false
+	}
+	if f.TagKey != "" {
+		value, isExist := event.Tags[f.TagKey]
+		if !isExist {
+			return false
+		}
+		if f.TagValue != "" {
+			if stringValue, ok := value.(string); !ok || stringValue != f.TagValue {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type Subscriber struct {
+	events  chan Event
+	filter  Filter
+	dropped counter.CounterStruct
+}
+
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscriber) Dropped() uint64 {
+	return s.dropped.Count()
+}
+
+var (
+	TotalEventsPublished counter.CounterStruct
+	TotalEventsDropped   counter.CounterStruct
+	CountSubscribers     counter.CounterStruct
+
+	subscribersMu sync.RWMutex
+	subscribers   = make(map[*Subscriber]struct{})
+)
+
+func Subscribe(filter Filter, buffer int) *Subscriber {
+	subscriber := &Subscriber{
+		events: make(chan Event, buffer),
+		filter: filter,
+	}
+	subscribersMu.Lock()
+	subscribers[subscriber] = struct{}{}
+	subscribersMu.Unlock()
+	CountSubscribers.Increment()
+	return subscriber
+}
+
+func Unsubscribe(subscriber *Subscriber) {
+	subscribersMu.Lock()
+	if _, isExist := subscribers[subscriber]; isExist {
+		delete(subscribers, subscriber)
+		CountSubscribers.Decrement()
+	}
+	subscribersMu.Unlock()
+}
+
+// HasSubscribers позволяет не собирать событие, когда его некому отправить
+func HasSubscribers() bool {
+	subscribersMu.RLock()
+	defer subscribersMu.RUnlock()
+	return len(subscribers) > 0
+}
+
+// Publish никогда не блокируется: если буфер подписчика заполнен, событие для него теряется
+func Publish(event Event) {
+	subscribersMu.RLock()
+	defer subscribersMu.RUnlock()
+	TotalEventsPublished.Increment()
+	for subscriber := range subscribers {
+		if !subscriber.filter.IsMatched(event) {
+			continue
+		}
+		select {
+		case subscriber.events <- event:
+		default:
+			subscriber.dropped.Increment()
+			TotalEventsDropped.Increment()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package stream_test
+
+import (
+	"testing"
+	"trace-monitor-collector/stream"
+	"trace-monitor-collector/tagFilter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishDeliversOnlyMatchedEvents(t *testing.T) {
+	// Arrange
+	tagKey, tagValue := tagFilter.Parse("service=api")
+	subscriber := stream.Subscribe(stream.Filter{SpanName: "Database query", TagKey: tagKey, TagValue: tagValue}, 10)
+	defer stream.Unsubscribe(subscriber)
+	tags := map[string]interface{}{"service": "api"}
+
+	// Act
+	stream.Publish(stream.Event{Type: stream.EventSpanSet, Pid: "1", SpanName: "Database query", Tags: tags})
+	stream.Publish(stream.Event{Type: stream.EventSpanSet, Pid: "1", SpanName: "Redis command", Tags: tags})
+	stream.Publish(stream.Event{Type: stream.EventSpanSet, Pid: "2", SpanName: "Database query", Tags: map[string]interface{}{"service": "cron"}})
+
+	// Assert
+	assert.Len(t, subscriber.Events(), 1)
+	event := <-subscriber.Events()
+	assert.Equal(t, "1", event.Pid)
+	assert.Equal(t, "Database query", event.SpanName)
+}
+
+func TestPublishDropsEventsForSlowSubscriberWithoutBlocking(t *testing.T) {
+	// Arrange
+	slowSubscriber := stream.Subscribe(stream.Filter{}, 2)
+	defer stream.Unsubscribe(slowSubscriber)
+	fastSubscriber := stream.Subscribe(stream.Filter{}, 10)
+	defer stream.Unsubscribe(fastSubscriber)
+	droppedBefore := stream.TotalEventsDropped.Count()
+
+	// Act
+	for i := 0; i < 5; i++ {
+		stream.Publish(stream.Event{Type: stream.EventInitTrace, Pid: "1"})
+	}
+
+	// Assert
+	assert.Len(t, slowSubscriber.Events(), 2)
+	assert.Equal(t, uint64(3), slowSubscriber.Dropped())
+	assert.Len(t, fastSubscriber.Events(), 5)
+	assert.Equal(t, droppedBefore+3, stream.TotalEventsDropped.Count())
+}
+
+func TestUnsubscribeStopsDelivery(t *testing.T) {
+	// Arrange
+	subscriber := stream.Subscribe(stream.Filter{}, 10)
+
+	// Act
+	stream.Unsubscribe(subscriber)
+	stream.Publish(stream.Event{Type: stream.EventFreePid, Pid: "1"})
+
+	// Assert
+	assert.Len(t, subscriber.Events(), 0)
+	assert.False(t, stream.HasSubscribers())
+}
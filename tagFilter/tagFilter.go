@@ -0,0 +1,12 @@
+package tagFilter
+
+import "strings"
+
+// Parse разбирает фильтр по тегу вида "key" или "key=value"
+func Parse(tag string) (string, string) {
+	parts := strings.SplitN(tag, "=", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
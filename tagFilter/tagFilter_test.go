@@ -0,0 +1,20 @@
+package tagFilter_test
+
+import (
+	"testing"
+	"trace-monitor-collector/tagFilter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSplitsKeyAndValue(t *testing.T) {
+	// Act
+	keyOnly, emptyValue := tagFilter.Parse("service")
+	key, value := tagFilter.Parse("route=a=b")
+
+	// Assert
+	assert.Equal(t, "service", keyOnly)
+	assert.Equal(t, "", emptyValue)
+	assert.Equal(t, "route", key)
+	assert.Equal(t, "a=b", value)
+}
@@ -0,0 +1,73 @@
+package traceCollection
+
+import (
+	"sort"
+	"trace-monitor-collector/counter"
+)
+
+var (
+	TotalEvictedByAdmin counter.CounterStruct
+)
+
+// EvictProcess удаляет трейс процесса по ключу хранилища без закрытия: обработчики закрытия не вызываются
+func EvictProcess(key string) bool {
+	if _, isExist := dataCollection.Load(key); !isExist {
+		return false
+	}
+	deleteTraceData(key)
+	forgetSeq(key)
+	TotalEvictedByAdmin.Increment()
+	return true
+}
+
+// EvictTrace удаляет трейс по traceId и возвращает ключи процессов, у которых он был открыт
+func EvictTrace(traceId string) []string {
+	var keys []string
+	dataCollection.Range(func(key, value interface{}) bool {
+		if (*value.(**dataStruct)).TraceId == traceId {
+			keys = append(keys, key.(string))
+		}
+		return true
+	})
+	evicted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if EvictProcess(key) {
+			evicted = append(evicted, key)
+		}
+	}
+	sort.Strings(evicted)
+	return evicted
+}
+
+// Clear удаляет все активные трейсы и возвращает их число
+func Clear() int {
+	var keys []string
+	dataCollection.Range(func(key, _ interface{}) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	var evicted int
+	for _, key := range keys {
+		if EvictProcess(key) {
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// ResetCounters обнуляет счётчики команд, в том числе по приложениям
+func ResetCounters() {
+	TotalTraceSet.Reset()
+	TotalSpanSet.Reset()
+	TotalTraceDelete.Reset()
+	TotalAllSpanClose.Reset()
+
+	appCountersMu.Lock()
+	defer appCountersMu.Unlock()
+	for _, counters := range appCounters {
+		counters.TraceSet.Reset()
+		counters.SpanSet.Reset()
+		counters.TraceDelete.Reset()
+		counters.AllSpanClose.Reset()
+	}
+}
@@ -0,0 +1,140 @@
+package traceCollection
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"trace-monitor-collector/config"
+)
+
+// Максимум событий, хранимых у одного трейса, старые вытесняются
+const maxTraceEvents = 100
+
+type enrichmentPacket struct {
+	Data struct {
+		Tags    map[string]interface{} `json:"tags"`
+		Context map[string]interface{} `json:"context"`
+	} `json:"data"`
+}
+
+type traceEvent struct {
+	Method string          `json:"method"`
+	SentAt time.Time       `json:"sentAt"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// enrichTrace дополняет уже открытый трейс, не трогая sentAt: обогащение не считается шагом выполнения
+func enrichTrace(cfg *config.Config, pid string, traceId string, method string, data []byte, update func(traceData *dataStruct, data []byte) error) error {
+	data, err := redactOnIngestion(cfg, data)
+	if err != nil {
+		return fmt.Errorf("skip %s command. %v", method, err)
+	}
+	data = truncateFields(cfg, data)
+	value, isExist := dataCollection.Load(pid)
+	if !isExist {
+		return fmt.Errorf("skip %s command. trace is not initialized", method)
+	}
+	traceData := *value.(**dataStruct)
+	if !isTraceIdIdentical(traceData, traceId) {
+		return fmt.Errorf("skip %s command. trace id mismatch", method)
+	}
+	if err := update(traceData, data); err != nil {
+		return fmt.Errorf("skip %s command. %v", method, err)
+	}
+	storeTraceData(cfg, pid, traceData)
+
+	return nil
+}
+
+// mergeObject дописывает поля в json объект, current может быть пустым
+func mergeObject(current []byte, fields map[string]interface{}) ([]byte, error) {
+	merged := make(map[string]interface{}, len(fields))
+	if current != nil {
+		if err := json.Unmarshal(current, &merged); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+// traceField достаёт tags или context из init-trace, пока они не были переопределены отдельными командами
+func traceField(traceData *dataStruct, field string) []byte {
+	var trace struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if traceData.Trace == nil || json.Unmarshal(traceData.Trace, &trace) != nil {
+		return nil
+	}
+	return trace.Data[field]
+}
+
+func traceDataOf(traceData *dataStruct) []byte {
+	var trace struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if traceData.Trace == nil || json.Unmarshal(traceData.Trace, &trace) != nil {
+		return nil
+	}
+	return trace.Data
+}
+
+func SetTraceTags(cfg *config.Config, pid string, traceId string, data []byte) error {
+	return enrichTrace(cfg, pid, traceId, "set-trace-tags", data, func(traceData *dataStruct, data []byte) error {
+		var packet enrichmentPacket
+		if err := json.Unmarshal(data, &packet); err != nil {
+			return err
+		}
+		current := traceData.Tags
+		if current == nil {
+			current = traceField(traceData, "tags")
+		}
+		tags, err := mergeObject(current, packet.Data.Tags)
+		if err != nil {
+			return err
+		}
+		traceData.Tags = tags
+		return nil
+	})
+}
+
+func AddTraceContext(cfg *config.Config, pid string, traceId string, data []byte) error {
+	return enrichTrace(cfg, pid, traceId, "add-trace-context", data, func(traceData *dataStruct, data []byte) error {
+		var packet enrichmentPacket
+		if err := json.Unmarshal(data, &packet); err != nil {
+			return err
+		}
+		current := traceData.Context
+		if current == nil {
+			current = traceField(traceData, "context")
+		}
+		context, err := mergeObject(current, packet.Data.Context)
+		if err != nil {
+			return err
+		}
+		traceData.Context = context
+		return nil
+	})
+}
+
+func AddTraceEvent(cfg *config.Config, pid string, traceId string, method string, sentAt time.Time, data []byte) error {
+	return enrichTrace(cfg, pid, traceId, method, data, func(traceData *dataStruct, data []byte) error {
+		var packet struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &packet); err != nil {
+			return err
+		}
+		event, err := json.Marshal(traceEvent{Method: method, SentAt: sentAt, Data: packet.Data})
+		if err != nil {
+			return err
+		}
+		if len(traceData.Events) >= maxTraceEvents {
+			traceData.Events = traceData.Events[1:]
+		}
+		traceData.Events = append(traceData.Events, event)
+		return nil
+	})
+}
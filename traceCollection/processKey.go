@@ -0,0 +1,104 @@
+package traceCollection
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+)
+
+// Максимум приложений со своими счётчиками, остальные попадают в overflowApp
+const (
+	maxApps     = 100
+	overflowApp = "__other__"
+)
+
+type AppCounters struct {
+	TraceSet     counter.CounterStruct
+	SpanSet      counter.CounterStruct
+	TraceDelete  counter.CounterStruct
+	AllSpanClose counter.CounterStruct
+}
+
+var (
+	localHostname, _ = os.Hostname()
+
+	appCountersMu sync.Mutex
+	// Приложение по умолчанию ("") есть всегда, чтобы его метрики отдавались и до первого пакета
+	appCounters = map[string]*AppCounters{"": {}}
+)
+
+// ProcessKey собирает ключ хранилища из app, host и pid.
+// Без app и host ключ совпадает с pid, поэтому у коллектора с одним приложением ничего не меняется.
+func ProcessKey(app string, host string, pid string) string {
+	if app == "" && host == "" {
+		return pid
+	}
+	return strings.ReplaceAll(app, "/", "_") + "/" + strings.ReplaceAll(host, "/", "_") + "/" + pid
+}
+
+func SplitProcessKey(key string) (app string, host string, pid string) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return "", "", key
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// Проверки через procfs и статус FPM имеют смысл только для процессов на той же машине
+func IsLocalHost(host string) bool {
+	return host == "" || host == localHostname
+}
+
+// FpmStatusKey собирает ключ процесса в статусе FPM: локальный хост и приложение из конфига пишутся пустыми,
+// так совпадают ключи источника статуса и трейса, что бы ни прислал процесс
+func FpmStatusKey(cfg *config.Config, app string, host string, pid string) string {
+	if app == cfg.AppName {
+		app = ""
+	}
+	if IsLocalHost(host) {
+		host = ""
+	}
+	return ProcessKey(app, host, pid)
+}
+
+// HasFpmStatusSource сообщает, опрашивается ли статус FPM процессов app на host
+func HasFpmStatusSource(cfg *config.Config, app string, host string) bool {
+	key := FpmStatusKey(cfg, app, host, "")
+	for _, source := range cfg.FpmStatusSources {
+		if FpmStatusKey(cfg, source.App, source.Host, "") == key {
+			return true
+		}
+	}
+	return false
+}
+
+func countersForKey(key string) *AppCounters {
+	app, _, _ := SplitProcessKey(key)
+	appCountersMu.Lock()
+	defer appCountersMu.Unlock()
+	counters, isExist := appCounters[app]
+	if isExist {
+		return counters
+	}
+	if len(appCounters) >= maxApps {
+		app = overflowApp
+		if counters, isExist = appCounters[app]; isExist {
+			return counters
+		}
+	}
+	counters = new(AppCounters)
+	appCounters[app] = counters
+	return counters
+}
+
+func CountersByApp() map[string]*AppCounters {
+	appCountersMu.Lock()
+	defer appCountersMu.Unlock()
+	result := make(map[string]*AppCounters, len(appCounters))
+	for app, counters := range appCounters {
+		result[app] = counters
+	}
+	return result
+}
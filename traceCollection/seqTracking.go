@@ -0,0 +1,108 @@
+package traceCollection
+
+import (
+	"sync"
+	"time"
+	"trace-monitor-collector/counter"
+)
+
+// Если seq упал сильнее, чем на это значение, считаем что клиент перезапустил нумерацию
+const seqRestartThreshold = 1000
+
+const (
+	seqStateMaxIdle        = time.Hour
+	seqStateCleanupEachNth = 10000
+)
+
+type seqState struct {
+	last       uint64
+	lost       uint64
+	lastSeenAt time.Time
+}
+
+var (
+	TotalSeqPackets  counter.CounterStruct
+	TotalLostPackets counter.CounterStruct
+
+	seqStatesMu   sync.Mutex
+	seqStates     = make(map[string]*seqState)
+	seqTrackCalls uint64
+)
+
+// TrackSeq учитывает seq пакета и оценивает потери между клиентом и коллектором по пропускам в нумерации.
+// Пакет, пришедший после более нового, уменьшает оценку потерь, которая была сделана при появлении пропуска.
+func TrackSeq(pid string, traceId string, seq uint64) {
+	if seq == 0 {
+		return
+	}
+	TotalSeqPackets.Increment()
+
+	var lost, recovered uint64
+	seqStatesMu.Lock()
+	state, isExist := seqStates[pid]
+	if !isExist {
+		state = &seqState{last: seq}
+		seqStates[pid] = state
+	} else if seq > state.last {
+		lost = seq - state.last - 1
+		state.lost += lost
+		state.last = seq
+	} else if state.last-seq > seqRestartThreshold {
+		*state = seqState{last: seq}
+	} else if seq < state.last && state.lost > 0 {
+		recovered = 1
+		state.lost--
+	}
+	state.lastSeenAt = time.Now()
+	seqTrackCalls++
+	if seqTrackCalls%seqStateCleanupEachNth == 0 {
+		cleanupSeqStates(state.lastSeenAt)
+	}
+	seqStatesMu.Unlock()
+
+	if lost == 0 && recovered == 0 {
+		return
+	}
+	for i := uint64(0); i < lost; i++ {
+		TotalLostPackets.Increment()
+	}
+	if recovered > 0 {
+		TotalLostPackets.Decrement()
+	}
+	if value, isExist := dataCollection.Load(pid); isExist {
+		traceData := *value.(**dataStruct)
+		if !isTraceIdIdentical(traceData, traceId) {
+			return
+		}
+		if recovered > 0 && traceData.LostPackets > 0 {
+			traceData.LostPackets--
+		}
+		traceData.LostPackets += lost
+	}
+}
+
+func forgetSeq(pid string) {
+	seqStatesMu.Lock()
+	delete(seqStates, pid)
+	seqStatesMu.Unlock()
+}
+
+// cleanupSeqStates вызывается под seqStatesMu
+func cleanupSeqStates(now time.Time) {
+	for pid, state := range seqStates {
+		if now.Sub(state.lastSeenAt) > seqStateMaxIdle {
+			delete(seqStates, pid)
+		}
+	}
+}
+
+func CountIncompleteTraces() uint64 {
+	var count uint64
+	dataCollection.Range(func(_, value interface{}) bool {
+		if (*value.(**dataStruct)).LostPackets > 0 {
+			count++
+		}
+		return true
+	})
+	return count
+}
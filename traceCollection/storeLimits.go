@@ -0,0 +1,104 @@
+package traceCollection
+
+import (
+	"container/list"
+	"sync"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+)
+
+type storeEntry struct {
+	key  string
+	size int
+}
+
+var (
+	TotalEvictedByEntries counter.CounterStruct
+	TotalEvictedByBytes   counter.CounterStruct
+
+	storeLimitsMu sync.Mutex
+	// Записи упорядочены от недавно обновлённых к давно не обновлявшимся
+	storeLru     = list.New()
+	storeEntries = make(map[string]*list.Element)
+	bytesHeld    int64
+)
+
+// BytesHeld возвращает оценку памяти под данные трейсов: сумму размеров сырых пакетов
+func BytesHeld() int64 {
+	storeLimitsMu.Lock()
+	defer storeLimitsMu.Unlock()
+	return bytesHeld
+}
+
+func entrySize(traceData *dataStruct) int {
+	size := len(traceData.Trace) + len(traceData.Span) + len(traceData.Context) + len(traceData.Tags)
+	for _, event := range traceData.Events {
+		size += len(event)
+	}
+	for _, traceError := range traceData.Errors {
+		size += len(traceError.Message) + len(traceError.Backtrace)
+	}
+	return size
+}
+
+func storeTraceData(cfg *config.Config, key string, traceData *dataStruct) {
+	dataCollection.Store(key, &traceData)
+	for _, evictedKey := range accountTraceData(cfg, key, entrySize(traceData)) {
+		storeLog.WarnLimited("evicted", "trace evicted by store limits", "pid", evictedKey)
+		if value, isExist := dataCollection.Load(evictedKey); isExist {
+			observeTraceDrop(*value.(**dataStruct), DropReasonEvicted, time.Now())
+		}
+		deleteTraceData(evictedKey)
+		forgetSeq(evictedKey)
+	}
+}
+
+// accountTraceData обновляет размер записи и возвращает ключи, которые нужно вытеснить.
+// Вытесняются давно не обновлявшиеся записи, только что обновлённая остаётся, даже если одна превышает бюджет.
+func accountTraceData(cfg *config.Config, key string, size int) []string {
+	storeLimitsMu.Lock()
+	defer storeLimitsMu.Unlock()
+	if element, isExist := storeEntries[key]; isExist {
+		entry := element.Value.(*storeEntry)
+		bytesHeld += int64(size - entry.size)
+		entry.size = size
+		storeLru.MoveToFront(element)
+	} else {
+		storeEntries[key] = storeLru.PushFront(&storeEntry{key: key, size: size})
+		bytesHeld += int64(size)
+	}
+
+	var evictedKeys []string
+	projectedBytes := bytesHeld
+	projectedEntries := storeLru.Len()
+	for element := storeLru.Back(); element != nil && element.Value.(*storeEntry).key != key; element = element.Prev() {
+		isOverEntries := cfg.StoreMaxEntries > 0 && projectedEntries > cfg.StoreMaxEntries
+		isOverBytes := cfg.StoreMaxBytes > 0 && projectedBytes > cfg.StoreMaxBytes
+		if !isOverEntries && !isOverBytes {
+			break
+		}
+		if isOverEntries {
+			TotalEvictedByEntries.Increment()
+		} else {
+			TotalEvictedByBytes.Increment()
+		}
+		entry := element.Value.(*storeEntry)
+		evictedKeys = append(evictedKeys, entry.key)
+		projectedBytes -= int64(entry.size)
+		projectedEntries--
+	}
+	return evictedKeys
+}
+
+func forgetTraceData(key string) {
+	storeLimitsMu.Lock()
+	defer storeLimitsMu.Unlock()
+	element, isExist := storeEntries[key]
+	if !isExist {
+		return
+	}
+	bytesHeld -= int64(element.Value.(*storeEntry).size)
+	storeLru.Remove(element)
+	delete(storeEntries, key)
+}
@@ -2,22 +2,114 @@ package traceCollection
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 	"trace-monitor-collector/config"
 	"trace-monitor-collector/counter"
+	"trace-monitor-collector/logger"
+	"trace-monitor-collector/procfs"
+	"trace-monitor-collector/redaction"
 )
 
 type dataStruct struct {
-	TraceId string
-	SentAt  time.Time
+	App        string
+	Host       string
+	Pid        string
+	TraceId    string
+	SentAt     time.Time
+	ReceivedAt time.Time
+	Seq        uint64
+	StartTime  uint64
+
+	LostPackets uint64
 
 	Trace   []byte
 	Span    []byte
-	Context []byte // Поле используется в httpServer перед выпиливанием проверить там
-	Tags    []byte // Поле используется в httpServer перед выпиливанием проверить там
+	Context []byte // Заполняется командой add-trace-context поверх context из init-trace
+	Tags    []byte // Заполняется командой set-trace-tags поверх tags из init-trace
+	Events  [][]byte
+	Errors  []TraceError
+	// Имена span трейса собираются только при включённом хранении завершённых трейсов
+	SpanNames []string
+}
+
+type tracePacket struct {
+	Data struct {
+		OpenedAt      time.Time `json:"openedAt"`
+		ServerContext struct {
+			Method string `json:"method"`
+			Uri    string `json:"uri"`
+		} `json:"serverContext"`
+	} `json:"data"`
+}
+
+type spanPacket struct {
+	Data struct {
+		Span struct {
+			Name     string                 `json:"name"`
+			OpenedAt time.Time              `json:"openedAt"`
+			Context  map[string]interface{} `json:"context"`
+		} `json:"span"`
+	} `json:"data"`
+}
+
+type ClosedSpan struct {
+	App      string
+	Pid      string
+	TraceId  string
+	Name     string
+	Duration time.Duration
+	Context  map[string]interface{}
+}
+
+type ClosedTrace struct {
+	App       string
+	Host      string
+	Pid       string
+	TraceId   string
+	Method    string
+	Uri       string
+	Duration  time.Duration
+	ClosedAt  time.Time
+	Errors    []TraceError
+	Tags      json.RawMessage
+	Context   json.RawMessage
+	Trace     json.RawMessage
+	SpanNames []string
+	Events    [][]byte
+	// DropReason задан, если трейс удалён без free-pid: процесс завис, умер или вытеснен лимитами хранилища
+	DropReason string
+}
+
+// Причины удаления трейса без закрытия
+const (
+	DropReasonHung     = "hung"
+	DropReasonIdle     = "idle"
+	DropReasonDead     = "dead"
+	DropReasonPidReuse = "pid_reuse"
+	DropReasonEvicted  = "evicted"
+)
+
+var (
+	spanCloseHandlers  []func(ClosedSpan)
+	traceCloseHandlers []func(ClosedTrace)
+	traceDropHandlers  []func(ClosedTrace)
+)
+
+// OnSpanClose и OnTraceClose регистрируют обработчики закрытия, вызывать до запуска приёма пакетов
+func OnSpanClose(handler func(ClosedSpan)) {
+	spanCloseHandlers = append(spanCloseHandlers, handler)
+}
+
+func OnTraceClose(handler func(ClosedTrace)) {
+	traceCloseHandlers = append(traceCloseHandlers, handler)
+}
+
+// OnTraceDrop регистрирует обработчик трейсов, удалённых без закрытия, причина в ClosedTrace.DropReason
+func OnTraceDrop(handler func(ClosedTrace)) {
+	traceDropHandlers = append(traceDropHandlers, handler)
 }
 
 type ChronologicalError struct {
@@ -35,101 +127,207 @@ var (
 	TotalTraceDelete  counter.CounterStruct
 	TotalAllSpanClose counter.CounterStruct
 	CountActivePid    counter.CounterStruct
+	TotalPidReuse     counter.CounterStruct
+	TotalPidDead      counter.CounterStruct
+	Redactor          *redaction.Redactor
+
+	storeLog = logger.New("store")
+
+	// Пул процесса по ключу хранилища из последнего статуса FPM, где он был.
+	// Опрос FPM пишет сюда, а не в трейс: трейс в dataCollection меняют только обработчики пакетов
+	processPoolsMu sync.RWMutex
+	processPools   = make(map[string]string)
 )
 
-func isChronologicalCorrect(traceData *dataStruct, newTime time.Time) (bool, error) {
-	if !traceData.SentAt.Before(newTime) {
-		return false, fmt.Errorf("message history is broken")
+func isChronologicalCorrect(cfg *config.Config, traceData *dataStruct, newTime time.Time, seq uint64) (bool, error) {
+	if traceData.SentAt.Before(newTime) {
+		return true, nil
+	}
+	if traceData.SentAt.Equal(newTime) {
+		// Одинаковое время отправки различаем по seq, а без него доверяем буферу переупорядочивания, который уже отбросил дубли
+		if seq != 0 && traceData.Seq != 0 {
+			if seq > traceData.Seq {
+				return true, nil
+			}
+		} else if cfg.ReorderWindowMs > 0 {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("message history is broken")
+}
+
+// LastSeenAt выбирает, от какого времени считать длительность трейса: при расхождении часов клиентов
+// время получения пакета коллектором надёжнее, чем sentAt
+func LastSeenAt(cfg *config.Config, sentAt time.Time, receivedAt time.Time) time.Time {
+	if cfg.UseReceiveTime && !receivedAt.IsZero() {
+		return receivedAt
 	}
-	return true, nil
+	return sentAt
 }
 
 func isTraceIdIdentical(traceData *dataStruct, traceId string) bool {
 	return traceData.TraceId == traceId
 }
 
-func createTraceData(pid string, traceId string) *dataStruct {
+func createTraceData(cfg *config.Config, key string, traceId string) *dataStruct {
 	newTraceData := new(dataStruct)
+	newTraceData.App, newTraceData.Host, newTraceData.Pid = SplitProcessKey(key)
 	newTraceData.TraceId = traceId
+	if cfg.PidLivenessCheck && IsLocalHost(newTraceData.Host) {
+		newTraceData.StartTime, _ = procfs.ReadStartTime(cfg.ProcRoot, newTraceData.Pid)
+	}
 
-	dataCollection.Store(pid, &newTraceData)
+	dataCollection.Store(key, &newTraceData)
 	CountActivePid.Increment()
 
 	return newTraceData
 }
 
-func deleteTraceData(pid string) {
-	dataCollection.Delete(pid)
-	CountActivePid.Decrement()
+// deleteTraceData уменьшает счётчик, только если запись ещё была: её мог удалить параллельный проход
+func deleteTraceData(key string) {
+	if _, isExist := dataCollection.LoadAndDelete(key); isExist {
+		forgetTraceData(key)
+		forgetPool(key)
+		CountActivePid.Decrement()
+	}
 }
 
-func InitTrace(cfg *config.Config, pid string, traceId string, sentAt time.Time, data []byte) error {
+// Процесс с тем же pid мог умереть и смениться новым, тогда старый трейс нужно выбросить
+// до проверки хронологии, иначе новый процесс унаследует чужие данные
+func evictIfPidReused(cfg *config.Config, pid string, traceId string) {
+	if !cfg.PidLivenessCheck {
+		return
+	}
+	value, isExist := dataCollection.Load(pid)
+	if !isExist {
+		return
+	}
+	traceData := *value.(**dataStruct)
+	if isTraceIdIdentical(traceData, traceId) || !IsLocalHost(traceData.Host) {
+		return
+	}
+	startTime, err := procfs.ReadStartTime(cfg.ProcRoot, traceData.Pid)
+	if err != nil || traceData.StartTime == 0 || traceData.StartTime == startTime {
+		return
+	}
+	storeLog.Warn("pid reused, drop stale trace", "pid", pid, "traceId", traceData.TraceId)
+	TotalPidReuse.Increment()
+	observeTraceDrop(traceData, DropReasonPidReuse, time.Now())
+	deleteTraceData(pid)
+	forgetSeq(pid)
+}
+
+func redactOnIngestion(cfg *config.Config, data []byte) ([]byte, error) {
+	if !cfg.Redaction.OnIngestion {
+		return data, nil
+	}
+	return Redactor.RedactCommand(data)
+}
+
+func InitTrace(cfg *config.Config, pid string, traceId string, sentAt time.Time, receivedAt time.Time, seq uint64, data []byte) error {
 	TotalTraceSet.Increment()
+	countersForKey(pid).TraceSet.Increment()
+	data, err := redactOnIngestion(cfg, data)
+	if err != nil {
+		return fmt.Errorf("skip set trace command. %v", err)
+	}
+	data = truncateFields(cfg, data)
+	evictIfPidReused(cfg, pid, traceId)
 	var traceData *dataStruct
 	if value, isExist := dataCollection.Load(pid); isExist {
 		traceData = *value.(**dataStruct)
 		if isTraceIdOk := isTraceIdIdentical(traceData, traceId); !isTraceIdOk {
-			if isChronologicalOk, err := isChronologicalCorrect(traceData, sentAt); !isChronologicalOk {
+			if isChronologicalOk, err := isChronologicalCorrect(cfg, traceData, sentAt, seq); !isChronologicalOk {
 				return fmt.Errorf("skip set trace command. %v", err)
 			}
-			if cfg.IsVerboseByLevel("v") {
-				log.Println("_warn: _", pid, "new trace without deleting `SetTrace`", traceId)
-			}
+			storeLog.WarnLimited("not-deleted", "new trace without deleting previous one", "pid", pid, "traceId", traceId, "method", "SetTrace")
 			deleteTraceData(pid)
-			traceData = createTraceData(pid, traceId)
+			traceData = createTraceData(cfg, pid, traceId)
 			traceData.SentAt = sentAt
+			traceData.ReceivedAt = receivedAt
+			traceData.Seq = seq
 		}
 	} else {
-		traceData = createTraceData(pid, traceId)
+		traceData = createTraceData(cfg, pid, traceId)
 		traceData.SentAt = sentAt
+		traceData.ReceivedAt = receivedAt
+		traceData.Seq = seq
 	}
 	traceData.Trace = data
-	dataCollection.Store(pid, &traceData)
+	storeTraceData(cfg, pid, traceData)
 
 	return nil
 }
 
-func SetTraceCurrentSpan(cfg *config.Config, pid string, traceId string, sentAt time.Time, data []byte) error {
+// Максимум различных имён span, запоминаемых у одного трейса
+const maxSpanNames = 100
+
+func appendSpanName(traceData *dataStruct, data []byte) {
+	var span spanPacket
+	if json.Unmarshal(data, &span) != nil || span.Data.Span.Name == "" {
+		return
+	}
+	for _, spanName := range traceData.SpanNames {
+		if spanName == span.Data.Span.Name {
+			return
+		}
+	}
+	if len(traceData.SpanNames) < maxSpanNames {
+		traceData.SpanNames = append(traceData.SpanNames, span.Data.Span.Name)
+	}
+}
+
+func SetTraceCurrentSpan(cfg *config.Config, pid string, traceId string, sentAt time.Time, receivedAt time.Time, seq uint64, data []byte) error {
 	TotalSpanSet.Increment()
+	countersForKey(pid).SpanSet.Increment()
+	data, err := redactOnIngestion(cfg, data)
+	if err != nil {
+		return fmt.Errorf("skip set span command. %v", err)
+	}
+	data = truncateFields(cfg, data)
+	evictIfPidReused(cfg, pid, traceId)
 	var traceData *dataStruct
 	if value, isExist := dataCollection.Load(pid); isExist {
 		traceData = *value.(**dataStruct)
-		if isChronologicalOk, err := isChronologicalCorrect(traceData, sentAt); !isChronologicalOk {
+		if isChronologicalOk, err := isChronologicalCorrect(cfg, traceData, sentAt, seq); !isChronologicalOk {
 			return fmt.Errorf("skip set span command. %v", err)
 		}
 		if isTraceIdOk := isTraceIdIdentical(traceData, traceId); !isTraceIdOk {
-			if cfg.IsVerboseByLevel("v") {
-				log.Println("_warn: _", pid, "new trace without deleting `SetSpan`", traceId)
-			}
+			storeLog.WarnLimited("not-deleted", "new trace without deleting previous one", "pid", pid, "traceId", traceId, "method", "SetSpan")
 			deleteTraceData(pid)
-			traceData = createTraceData(pid, traceId)
+			traceData = createTraceData(cfg, pid, traceId)
 		}
 	} else {
-		traceData = createTraceData(pid, traceId)
+		traceData = createTraceData(cfg, pid, traceId)
 	}
 
 	traceData.SentAt = sentAt
+	traceData.ReceivedAt = receivedAt
+	traceData.Seq = seq
 	traceData.Span = data
-	dataCollection.Store(pid, &traceData)
+	if cfg.Retention.Keep > 0 {
+		appendSpanName(traceData, data)
+	}
+	storeTraceData(cfg, pid, traceData)
 
 	return nil
 }
 
-func DeleteSpan(cfg *config.Config, pid string, traceId string, sentAt time.Time) error {
+func DeleteSpan(cfg *config.Config, pid string, traceId string, sentAt time.Time, seq uint64) error {
 	TotalAllSpanClose.Increment()
+	countersForKey(pid).AllSpanClose.Increment()
 	var traceData *dataStruct
 	if value, isExist := dataCollection.Load(pid); isExist {
 		traceData = *value.(**dataStruct)
-		if isChronologicalOk, err := isChronologicalCorrect(traceData, sentAt); !isChronologicalOk {
+		if isChronologicalOk, err := isChronologicalCorrect(cfg, traceData, sentAt, seq); !isChronologicalOk {
 			return fmt.Errorf("skip delete span command. %v", err)
 		}
 		if isTraceIdOk := isTraceIdIdentical(traceData, traceId); isTraceIdOk {
+			observeSpanClose(pid, traceData, sentAt)
 			traceData.Span = nil
-			dataCollection.Store(pid, &traceData)
+			storeTraceData(cfg, pid, traceData)
 		} else {
-			if cfg.IsVerboseByLevel("v") {
-				log.Println("_warn: _", pid, "new trace without deleting `DeleteSpan`", traceId)
-			}
+			storeLog.WarnLimited("not-deleted", "new trace without deleting previous one", "pid", pid, "traceId", traceId, "method", "DeleteSpan")
 			deleteTraceData(pid)
 		}
 	}
@@ -137,18 +335,19 @@ func DeleteSpan(cfg *config.Config, pid string, traceId string, sentAt time.Time
 	return nil
 }
 
-func DeleteTrace(cfg *config.Config, pid string, traceId string, sentAt time.Time) error {
+func DeleteTrace(cfg *config.Config, pid string, traceId string, sentAt time.Time, seq uint64) error {
 	TotalTraceDelete.Increment()
+	countersForKey(pid).TraceDelete.Increment()
 	var traceData *dataStruct
 	if value, isExist := dataCollection.Load(pid); isExist {
 		traceData = *value.(**dataStruct)
-		if isChronologicalOk, err := isChronologicalCorrect(traceData, sentAt); !isChronologicalOk {
+		if isChronologicalOk, err := isChronologicalCorrect(cfg, traceData, sentAt, seq); !isChronologicalOk {
 			return fmt.Errorf("skip delete trace command. %v", err)
 		}
 		if isTraceIdOk := isTraceIdIdentical(traceData, traceId); !isTraceIdOk {
-			if cfg.IsVerboseByLevel("v") {
-				log.Println("_warn: _", pid, "new trace without deleting `DeleteTrace`", traceId)
-			}
+			storeLog.WarnLimited("not-deleted", "new trace without deleting previous one", "pid", pid, "traceId", traceId, "method", "DeleteTrace")
+		} else {
+			observeTraceClose(pid, traceData, sentAt)
 		}
 		deleteTraceData(pid)
 	}
@@ -156,6 +355,87 @@ func DeleteTrace(cfg *config.Config, pid string, traceId string, sentAt time.Tim
 	return nil
 }
 
+func observeSpanClose(pid string, traceData *dataStruct, closedAt time.Time) {
+	if len(spanCloseHandlers) == 0 || traceData.Span == nil {
+		return
+	}
+	var span spanPacket
+	if err := json.Unmarshal(traceData.Span, &span); err != nil || span.Data.Span.OpenedAt.IsZero() {
+		return
+	}
+	closedSpan := ClosedSpan{
+		App:      traceData.App,
+		Pid:      traceData.Pid,
+		TraceId:  traceData.TraceId,
+		Name:     span.Data.Span.Name,
+		Duration: closedAt.Sub(span.Data.Span.OpenedAt),
+		Context:  span.Data.Span.Context,
+	}
+	for _, handler := range spanCloseHandlers {
+		handler(closedSpan)
+	}
+}
+
+func observeTraceClose(pid string, traceData *dataStruct, closedAt time.Time) {
+	if len(traceCloseHandlers) == 0 {
+		return
+	}
+	closedTrace, isOk := closedTraceOf(traceData, closedAt)
+	if !isOk {
+		return
+	}
+	for _, handler := range traceCloseHandlers {
+		handler(closedTrace)
+	}
+}
+
+func observeTraceDrop(traceData *dataStruct, reason string, droppedAt time.Time) {
+	if len(traceDropHandlers) == 0 {
+		return
+	}
+	droppedTrace, isOk := closedTraceOf(traceData, droppedAt)
+	if !isOk {
+		return
+	}
+	droppedTrace.DropReason = reason
+	for _, handler := range traceDropHandlers {
+		handler(droppedTrace)
+	}
+}
+
+func closedTraceOf(traceData *dataStruct, closedAt time.Time) (ClosedTrace, bool) {
+	if traceData.Trace == nil {
+		return ClosedTrace{}, false
+	}
+	var trace tracePacket
+	if err := json.Unmarshal(traceData.Trace, &trace); err != nil || trace.Data.OpenedAt.IsZero() {
+		return ClosedTrace{}, false
+	}
+	closedTrace := ClosedTrace{
+		App:       traceData.App,
+		Host:      traceData.Host,
+		Pid:       traceData.Pid,
+		TraceId:   traceData.TraceId,
+		Method:    trace.Data.ServerContext.Method,
+		Uri:       trace.Data.ServerContext.Uri,
+		Duration:  closedAt.Sub(trace.Data.OpenedAt),
+		ClosedAt:  closedAt,
+		Errors:    traceData.Errors,
+		Tags:      traceData.Tags,
+		Context:   traceData.Context,
+		Trace:     traceDataOf(traceData),
+		SpanNames: traceData.SpanNames,
+		Events:    traceData.Events,
+	}
+	if closedTrace.Tags == nil {
+		closedTrace.Tags = traceField(traceData, "tags")
+	}
+	if closedTrace.Context == nil {
+		closedTrace.Context = traceField(traceData, "context")
+	}
+	return closedTrace, true
+}
+
 func GetAllTrace() map[string][]byte {
 	var localTraceCollection = make(map[string][]byte)
 	dataCollection.Range(func(pid, value interface{}) bool {
@@ -166,27 +446,163 @@ func GetAllTrace() map[string][]byte {
 	return localTraceCollection
 }
 
-func CheckingForHung(cfg *config.Config, fpmStatusPIDmap map[string]map[string]interface{}) {
-	dataCollection.Range(func(Pid, value interface{}) bool {
+// FindByTraceId ищет активный трейс перебором, подходит только для редких запросов
+func FindByTraceId(traceId string) []byte {
+	var jsonBytes []byte
+	dataCollection.Range(func(_, value interface{}) bool {
 		valueData := **value.(**dataStruct)
+		if valueData.TraceId != traceId {
+			return true
+		}
+		jsonBytes, _ = json.Marshal(valueData)
+		return false
+	})
+	return jsonBytes
+}
+
+func GetTraceTags(pid string) map[string]interface{} {
+	value, isExist := dataCollection.Load(pid)
+	if !isExist {
+		return nil
+	}
+	return tagsOf(*value.(**dataStruct))
+}
+
+// RangeActiveTraces вызывает handler для каждого открытого трейса с его приложением и тегами
+func RangeActiveTraces(handler func(app string, tags map[string]interface{})) {
+	dataCollection.Range(func(_, value interface{}) bool {
+		traceData := *value.(**dataStruct)
+		handler(traceData.App, tagsOf(traceData))
+		return true
+	})
+}
+
+func tagsOf(traceData *dataStruct) map[string]interface{} {
+	if traceData.Tags != nil {
+		var tags map[string]interface{}
+		json.Unmarshal(traceData.Tags, &tags)
+		return tags
+	}
+	var trace struct {
+		Data struct {
+			Tags map[string]interface{} `json:"tags"`
+		} `json:"data"`
+	}
+	json.Unmarshal(traceData.Trace, &trace)
+	return trace.Data.Tags
+}
+
+func GetCurrentSpanName(pid string) string {
+	value, isExist := dataCollection.Load(pid)
+	if !isExist {
+		return ""
+	}
+	var span spanPacket
+	json.Unmarshal((*value.(**dataStruct)).Span, &span)
+	return span.Data.Span.Name
+}
+
+// CheckingForHung удаляет трейсы зависших процессов, которых нет в статусе FPM или которые простаивают, и возвращает их число
+func CheckingForHung(cfg *config.Config, fpmStatusPIDmap map[string]map[string]interface{}, failedPools map[string]bool) int {
+	var removed int
+	dataCollection.Range(func(Pid, value interface{}) bool {
+		traceData := *value.(**dataStruct)
 		localPid := Pid.(string)
-		if time.Since(valueData.SentAt) < (cfg.StuckProcessDuration * time.Second) {
+		// Процессы, статус FPM которых не опрашивается, им не проверить
+		if !HasFpmStatusSource(cfg, traceData.App, traceData.Host) {
 			return true
 		}
-		if cfg.IsVerboseByLevel("v") {
-			log.Printf("CheckingForHung - %v", localPid)
+		pidInfo, isExist := fpmStatusPIDmap[FpmStatusKey(cfg, traceData.App, traceData.Host, traceData.Pid)]
+		if isExist {
+			pool, _ := pidInfo["pool"].(string)
+			rememberPool(localPid, pool)
 		}
-		pidInfo, isExist := fpmStatusPIDmap[localPid]
+		valueData := *traceData
+		pool := PoolOf(localPid)
+		if time.Since(LastSeenAt(cfg, valueData.SentAt, valueData.ReceivedAt)) < cfg.StuckProcessDurationByApp(valueData.App) {
+			return true
+		}
+		storeLog.Info("checking for hung", "pid", localPid)
 		if !isExist {
-			if cfg.IsVerboseByLevel("v") {
-				log.Println("Process PID missing:", localPid, valueData.TraceId)
+			// Статус пула не загрузился, поэтому отсутствие pid ничего не значит
+			if failedPools[pool] || (pool == "" && len(failedPools) > 0) {
+				return true
 			}
+			storeLog.Info("process pid missing in fpm status", "pid", localPid, "traceId", valueData.TraceId)
+			observeTraceDrop(&valueData, DropReasonHung, time.Now())
 			deleteTraceData(localPid)
+			removed++
 		} else if pidInfo["state"] == "Idle" {
-			if cfg.IsVerboseByLevel("v") {
-				log.Println("delete by Idle")
-			}
+			storeLog.Info("delete by idle", "pid", localPid, "traceId", valueData.TraceId)
+			observeTraceDrop(&valueData, DropReasonIdle, time.Now())
+			deleteTraceData(localPid)
+			removed++
+		}
+		return true
+	})
+	return removed
+}
+
+func rememberPool(key string, pool string) {
+	processPoolsMu.Lock()
+	processPools[key] = pool
+	processPoolsMu.Unlock()
+}
+
+func forgetPool(key string) {
+	processPoolsMu.Lock()
+	delete(processPools, key)
+	processPoolsMu.Unlock()
+}
+
+// PoolOf возвращает пул процесса по ключу хранилища, пустой, если статус FPM его ещё не видел
+func PoolOf(key string) string {
+	processPoolsMu.RLock()
+	defer processPoolsMu.RUnlock()
+	return processPools[key]
+}
+
+// CountActivePidByAppPool возвращает число активных процессов по приложению и пулу
+func CountActivePidByAppPool() map[string]map[string]uint64 {
+	var countByApp = map[string]map[string]uint64{"": {}}
+	knownApps := CountersByApp()
+	dataCollection.Range(func(key, value interface{}) bool {
+		valueData := *value.(**dataStruct)
+		app := valueData.App
+		if _, isExist := knownApps[app]; !isExist {
+			app = overflowApp
+		}
+		if countByApp[app] == nil {
+			countByApp[app] = make(map[string]uint64)
+		}
+		countByApp[app][PoolOf(key.(string))]++
+		return true
+	})
+	return countByApp
+}
+
+func CheckingPidLiveness(cfg *config.Config) {
+	dataCollection.Range(func(Pid, value interface{}) bool {
+		valueData := **value.(**dataStruct)
+		localPid := Pid.(string)
+		if !IsLocalHost(valueData.Host) {
+			return true
+		}
+		startTime, err := procfs.ReadStartTime(cfg.ProcRoot, valueData.Pid)
+		if errors.Is(err, procfs.ErrProcessNotFound) {
+			storeLog.Info("process is dead", "pid", localPid, "traceId", valueData.TraceId)
+			TotalPidDead.Increment()
+			observeTraceDrop(&valueData, DropReasonDead, time.Now())
+			deleteTraceData(localPid)
+			forgetSeq(localPid)
+		} else if err != nil {
+			storeLog.WarnLimited("read-stat", "read process stat error", "pid", localPid, "err", err)
+		} else if valueData.StartTime != 0 && valueData.StartTime != startTime {
+			storeLog.Warn("process pid reused", "pid", localPid, "traceId", valueData.TraceId)
+			TotalPidReuse.Increment()
+			observeTraceDrop(&valueData, DropReasonPidReuse, time.Now())
 			deleteTraceData(localPid)
+			forgetSeq(localPid)
 		}
 		return true
 	})
@@ -0,0 +1,338 @@
+package traceCollection_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/traceCollection"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeStat(t *testing.T, root string, pid string, startTime uint64) {
+	require.Nil(t, os.MkdirAll(filepath.Join(root, pid), 0o755))
+	stat := fmt.Sprintf("%s (php-fpm) S 1 %s %s 0 -1 4194624 80 0 0 0 0 0 0 0 20 0 1 0 %d 2703360 286\n", pid, pid, pid, startTime)
+	require.Nil(t, os.WriteFile(filepath.Join(root, pid, "stat"), []byte(stat), 0o644))
+}
+
+func livenessConfig(procRoot string) *config.Config {
+	return &config.Config{
+		ProcRoot:             procRoot,
+		PidLivenessCheck:     true,
+		StuckProcessDuration: 10,
+	}
+}
+
+func TestInitTraceEvictsStaleTraceWhenPidReused(t *testing.T) {
+	// Arrange
+	root := t.TempDir()
+	cfg := livenessConfig(root)
+	sentAt := time.Now()
+	writeStat(t, root, "100", 1000)
+	require.Nil(t, traceCollection.InitTrace(cfg, "100", "old-trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+	writeStat(t, root, "100", 2000)
+	reuseBefore := traceCollection.TotalPidReuse.Count()
+
+	// Act
+	err := traceCollection.InitTrace(cfg, "100", "new-trace", sentAt.Add(-time.Second), time.Time{}, 0, []byte(`{}`))
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, reuseBefore+1, traceCollection.TotalPidReuse.Count())
+	assert.Contains(t, string(traceCollection.GetAllTrace()["100"]), "new-trace")
+
+	traceCollection.DeleteTrace(cfg, "100", "new-trace", sentAt, 0)
+}
+
+func TestCheckingPidLivenessEvictsDeadAndReusedPids(t *testing.T) {
+	// Arrange
+	root := t.TempDir()
+	cfg := livenessConfig(root)
+	sentAt := time.Now()
+	writeStat(t, root, "200", 1000)
+	writeStat(t, root, "201", 1000)
+	writeStat(t, root, "202", 1000)
+	require.Nil(t, traceCollection.InitTrace(cfg, "200", "alive-trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+	require.Nil(t, traceCollection.InitTrace(cfg, "201", "dead-trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+	require.Nil(t, traceCollection.InitTrace(cfg, "202", "reused-trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+	require.Nil(t, os.RemoveAll(filepath.Join(root, "201")))
+	writeStat(t, root, "202", 3000)
+	deadBefore := traceCollection.TotalPidDead.Count()
+	reuseBefore := traceCollection.TotalPidReuse.Count()
+
+	// Act
+	traceCollection.CheckingPidLiveness(cfg)
+
+	// Assert
+	traces := traceCollection.GetAllTrace()
+	assert.Contains(t, traces, "200")
+	assert.NotContains(t, traces, "201")
+	assert.NotContains(t, traces, "202")
+	assert.Equal(t, deadBefore+1, traceCollection.TotalPidDead.Count())
+	assert.Equal(t, reuseBefore+1, traceCollection.TotalPidReuse.Count())
+
+	traceCollection.DeleteTrace(cfg, "200", "alive-trace", sentAt.Add(time.Second), 0)
+}
+
+func TestSetTraceCurrentSpanAcceptsIdenticalSentAtWithGreaterSeq(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{StuckProcessDuration: 10}
+	sentAt := time.Now()
+	require.Nil(t, traceCollection.InitTrace(cfg, "300", "seq-trace", sentAt, time.Time{}, 1, []byte(`{}`)))
+
+	// Act
+	errWithGreaterSeq := traceCollection.SetTraceCurrentSpan(cfg, "300", "seq-trace", sentAt, time.Time{}, 2, []byte(`{}`))
+	errWithSameSeq := traceCollection.SetTraceCurrentSpan(cfg, "300", "seq-trace", sentAt, time.Time{}, 2, []byte(`{}`))
+
+	// Assert
+	assert.Nil(t, errWithGreaterSeq)
+	assert.NotNil(t, errWithSameSeq)
+
+	traceCollection.DeleteTrace(cfg, "300", "seq-trace", sentAt.Add(time.Second), 3)
+}
+
+func TestTrackSeqEstimatesLostPacketsAndRecoversLateOnes(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{}
+	sentAt := time.Now()
+	require.Nil(t, traceCollection.InitTrace(cfg, "400", "trace", sentAt, time.Time{}, 10, []byte(`{}`)))
+	traceCollection.TrackSeq("400", "trace", 10)
+	lostBefore := traceCollection.TotalLostPackets.Count()
+
+	// Act
+	traceCollection.TrackSeq("400", "trace", 14)
+	traceCollection.TrackSeq("400", "trace", 12)
+
+	// Assert
+	assert.Equal(t, lostBefore+2, traceCollection.TotalLostPackets.Count())
+	assert.Contains(t, string(traceCollection.GetAllTrace()["400"]), `"LostPackets":2`)
+
+	traceCollection.DeleteTrace(cfg, "400", "trace", sentAt.Add(time.Second), 0)
+}
+
+func TestProcessKeySeparatesSamePidOfDifferentApps(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{}
+	sentAt := time.Now()
+	billingKey := traceCollection.ProcessKey("billing", "web-1", "500")
+
+	// Act
+	require.Nil(t, traceCollection.InitTrace(cfg, "500", "default-trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+	require.Nil(t, traceCollection.InitTrace(cfg, billingKey, "billing-trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+
+	// Assert
+	traces := traceCollection.GetAllTrace()
+	assert.Contains(t, string(traces["500"]), "default-trace")
+	assert.Contains(t, string(traces[billingKey]), "billing-trace")
+	assert.Contains(t, string(traces[billingKey]), `"App":"billing","Host":"web-1","Pid":"500"`)
+	assert.Equal(t, uint64(1), traceCollection.CountActivePidByAppPool()["billing"][""])
+	assert.Equal(t, uint64(1), traceCollection.CountersByApp()["billing"].TraceSet.Count())
+
+	traceCollection.DeleteTrace(cfg, "500", "default-trace", sentAt.Add(time.Second), 0)
+	traceCollection.DeleteTrace(cfg, billingKey, "billing-trace", sentAt.Add(time.Second), 0)
+}
+
+func TestSetTraceTagsMergesWithInitTraceTags(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{}
+	sentAt := time.Now()
+	require.Nil(t, traceCollection.InitTrace(cfg, "600", "trace", sentAt, time.Time{}, 0, []byte(`{"data":{"tags":{"service":"api"}}}`)))
+
+	// Act
+	err := traceCollection.SetTraceTags(cfg, "600", "trace", []byte(`{"data":{"tags":{"userId":"42"}}}`))
+	otherErr := traceCollection.SetTraceTags(cfg, "600", "other-trace", []byte(`{"data":{"tags":{"userId":"13"}}}`))
+
+	// Assert
+	assert.Nil(t, err)
+	assert.NotNil(t, otherErr)
+	assert.Equal(t, map[string]interface{}{"service": "api", "userId": "42"}, traceCollection.GetTraceTags("600"))
+
+	traceCollection.DeleteTrace(cfg, "600", "trace", sentAt.Add(time.Second), 0)
+}
+
+func TestAddTraceEventKeepsLastEvents(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{}
+	sentAt := time.Now()
+	require.Nil(t, traceCollection.InitTrace(cfg, "601", "trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+
+	// Act
+	for i := 0; i < 150; i++ {
+		require.Nil(t, traceCollection.AddTraceEvent(cfg, "601", "trace", "span-event", sentAt, []byte(fmt.Sprintf(`{"data":{"name":"event-%d"}}`, i))))
+	}
+
+	// Assert
+	var traceData struct {
+		Events [][]byte
+	}
+	require.Nil(t, json.Unmarshal(traceCollection.GetAllTrace()["601"], &traceData))
+	assert.Len(t, traceData.Events, 100)
+	assert.Contains(t, string(traceData.Events[99]), "event-149")
+
+	traceCollection.DeleteTrace(cfg, "601", "trace", sentAt.Add(time.Second), 0)
+}
+
+func TestAddTraceErrorAttachesErrorToCurrentSpan(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{}
+	sentAt := time.Now()
+	require.Nil(t, traceCollection.InitTrace(cfg, "800", "trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+	require.Nil(t, traceCollection.SetTraceCurrentSpan(cfg, "800", "trace", sentAt.Add(time.Millisecond), time.Time{}, 0, []byte(`{"data":{"span":{"name":"Database query"}}}`)))
+	errorsBefore := traceCollection.TotalTraceErrors.Count()
+
+	// Act
+	err := traceCollection.AddTraceError(cfg, "800", "trace", traceCollection.TraceError{Class: "PDOException", Message: "deadlock"})
+	otherErr := traceCollection.AddTraceError(cfg, "800", "other-trace", traceCollection.TraceError{Class: "PDOException"})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.NotNil(t, otherErr)
+	assert.Equal(t, errorsBefore+1, traceCollection.TotalTraceErrors.Count())
+	var traceData struct {
+		Errors []traceCollection.TraceError
+	}
+	require.Nil(t, json.Unmarshal(traceCollection.GetAllTrace()["800"], &traceData))
+	require.Len(t, traceData.Errors, 1)
+	assert.Equal(t, "Database query", traceData.Errors[0].Span)
+	assert.Equal(t, "deadlock", traceData.Errors[0].Message)
+
+	traceCollection.DeleteTrace(cfg, "800", "trace", sentAt.Add(time.Second), 0)
+}
+
+func TestStoreMaxEntriesEvictsLeastRecentlyUpdated(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{StoreMaxEntries: 2}
+	sentAt := time.Now()
+	require.Nil(t, traceCollection.InitTrace(cfg, "900", "first", sentAt, time.Time{}, 0, []byte(`{}`)))
+	require.Nil(t, traceCollection.InitTrace(cfg, "901", "second", sentAt, time.Time{}, 0, []byte(`{}`)))
+	require.Nil(t, traceCollection.SetTraceCurrentSpan(cfg, "900", "first", sentAt.Add(time.Millisecond), time.Time{}, 0, []byte(`{}`)))
+	traceCollection.TrackSeq("901", "second", 5)
+	evictedBefore := traceCollection.TotalEvictedByEntries.Count()
+
+	// Act
+	require.Nil(t, traceCollection.InitTrace(cfg, "902", "third", sentAt, time.Time{}, 0, []byte(`{}`)))
+
+	// Assert
+	traces := traceCollection.GetAllTrace()
+	assert.Contains(t, traces, "900")
+	assert.NotContains(t, traces, "901")
+	assert.Contains(t, traces, "902")
+	assert.Equal(t, evictedBefore+1, traceCollection.TotalEvictedByEntries.Count())
+	lostBefore := traceCollection.TotalLostPackets.Count()
+	traceCollection.TrackSeq("901", "next", 10)
+	assert.Equal(t, lostBefore, traceCollection.TotalLostPackets.Count(), "seq of the evicted process must start over")
+
+	traceCollection.DeleteTrace(cfg, "900", "first", sentAt.Add(time.Second), 0)
+	traceCollection.DeleteTrace(cfg, "902", "third", sentAt.Add(time.Second), 0)
+}
+
+func TestSetTraceCurrentSpanTruncatesLongDebugTrace(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{MaxFieldBytes: 100, TruncateFields: []string{"debugTrace"}}
+	sentAt := time.Now()
+	frames := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		frames = append(frames, fmt.Sprintf(`{"file":"/app/src/Service%d.php","line":%d}`, i, i))
+	}
+	span := `{"data":{"span":{"name":"Database query","debugTrace":[` + strings.Join(frames, ",") + `]}}}`
+	require.Nil(t, traceCollection.InitTrace(cfg, "903", "trace", sentAt, time.Time{}, 0, []byte(`{}`)))
+	truncatedBefore := traceCollection.TotalTruncatedFields.Count()
+
+	// Act
+	err := traceCollection.SetTraceCurrentSpan(cfg, "903", "trace", sentAt.Add(time.Millisecond), time.Time{}, 0, []byte(span))
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, truncatedBefore+1, traceCollection.TotalTruncatedFields.Count())
+	assert.Equal(t, "Database query", traceCollection.GetCurrentSpanName("903"))
+	var traceData struct {
+		Span []byte
+	}
+	require.Nil(t, json.Unmarshal(traceCollection.GetAllTrace()["903"], &traceData))
+	assert.Contains(t, string(traceData.Span), "Service0.php")
+	assert.Contains(t, string(traceData.Span), "more items truncated")
+	assert.NotContains(t, string(traceData.Span), "Service19.php")
+
+	traceCollection.DeleteTrace(cfg, "903", "trace", sentAt.Add(time.Second), 0)
+}
+
+func TestCheckingForHungReportsDroppedTraceWithReason(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{FpmStatusSources: []config.FpmStatusSource{{Name: "www"}}}
+	sentAt := time.Now().Add(-time.Minute)
+	var dropped []traceCollection.ClosedTrace
+	traceCollection.OnTraceDrop(func(trace traceCollection.ClosedTrace) {
+		if trace.TraceId == "hung-trace" {
+			dropped = append(dropped, trace)
+		}
+	})
+	openedAt := sentAt.Add(-time.Second).Format(time.RFC3339Nano)
+	require.Nil(t, traceCollection.InitTrace(cfg, "990", "hung-trace", sentAt, time.Time{}, 0, []byte(`{"data":{"openedAt":"`+openedAt+`","serverContext":{"method":"GET","uri":"/cars"}}}`)))
+
+	// Act
+	removed := traceCollection.CheckingForHung(cfg, map[string]map[string]interface{}{}, map[string]bool{})
+
+	// Assert
+	assert.GreaterOrEqual(t, removed, 1)
+	require.Len(t, dropped, 1)
+	assert.Equal(t, traceCollection.DropReasonHung, dropped[0].DropReason)
+	assert.Equal(t, "/cars", dropped[0].Uri)
+	assert.Empty(t, traceCollection.FindByTraceId("hung-trace"))
+}
+
+func TestCheckingForHungMatchesProcessesByHost(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{FpmStatusSources: []config.FpmStatusSource{{Name: "www"}, {Name: "remote", Host: "web-2"}}}
+	sentAt := time.Now().Add(-time.Minute)
+	remoteKey := traceCollection.ProcessKey("", "web-2", "995")
+	defer traceCollection.EvictProcess(remoteKey)
+	defer traceCollection.EvictProcess("995")
+	defer traceCollection.EvictProcess(traceCollection.ProcessKey("", "web-3", "995"))
+	require.Nil(t, traceCollection.InitTrace(cfg, "995", "local-host-trace", sentAt, time.Time{}, 0, []byte(`{"data":{}}`)))
+	require.Nil(t, traceCollection.InitTrace(cfg, remoteKey, "remote-host-trace", sentAt, time.Time{}, 0, []byte(`{"data":{}}`)))
+	require.Nil(t, traceCollection.InitTrace(cfg, traceCollection.ProcessKey("", "web-3", "995"), "unpolled-host-trace", sentAt, time.Time{}, 0, []byte(`{"data":{}}`)))
+	fpmStatusPidMap := map[string]map[string]interface{}{
+		traceCollection.FpmStatusKey(cfg, "", "web-2", "995"): {"pool": "remote", "state": "Running"},
+	}
+
+	// Act
+	traceCollection.CheckingForHung(cfg, fpmStatusPidMap, map[string]bool{})
+
+	// Assert
+	assert.Empty(t, traceCollection.FindByTraceId("local-host-trace"))
+	assert.NotEmpty(t, traceCollection.FindByTraceId("remote-host-trace"))
+	assert.NotEmpty(t, traceCollection.FindByTraceId("unpolled-host-trace"))
+	assert.Equal(t, "remote", traceCollection.PoolOf(remoteKey))
+	assert.Equal(t, uint64(1), traceCollection.CountActivePidByAppPool()[""]["remote"])
+}
+
+func TestCheckingForHungRunsAlongsidePacketHandlers(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{StuckProcessDuration: 3600, FpmStatusSources: []config.FpmStatusSource{{Name: "www"}}}
+	sentAt := time.Now()
+	defer traceCollection.EvictProcess("996")
+	require.Nil(t, traceCollection.InitTrace(cfg, "996", "polled-trace", sentAt, time.Time{}, 0, []byte(`{"data":{}}`)))
+	fpmStatusPidMap := map[string]map[string]interface{}{"996": {"pool": "www", "state": "Running"}}
+	done := make(chan struct{})
+
+	// Act
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			traceCollection.CheckingForHung(cfg, fpmStatusPidMap, map[string]bool{})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		require.Nil(t, traceCollection.SetTraceCurrentSpan(cfg, "996", "polled-trace", sentAt.Add(time.Duration(i+1)*time.Millisecond), time.Time{}, 0, []byte(`{}`)))
+	}
+	<-done
+
+	// Assert
+	assert.Equal(t, "www", traceCollection.PoolOf("996"))
+}
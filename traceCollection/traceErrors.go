@@ -0,0 +1,90 @@
+package traceCollection
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+)
+
+// Максимум ошибок, хранимых у одного трейса, старые вытесняются
+const maxTraceErrors = 20
+
+type TraceError struct {
+	Class     string          `json:"class"`
+	Message   string          `json:"message"`
+	Backtrace json.RawMessage `json:"backtrace,omitempty"`
+	Span      string          `json:"span,omitempty"`
+	SentAt    time.Time       `json:"sentAt"`
+}
+
+type RecordedError struct {
+	App       string
+	Pid       string
+	TraceId   string
+	Error     TraceError
+	TagValues map[string]interface{}
+}
+
+var (
+	TotalTraceErrors counter.CounterStruct
+
+	traceErrorHandlers []func(RecordedError)
+)
+
+// OnTraceError регистрирует обработчик записанных ошибок, вызывать до запуска приёма пакетов
+func OnTraceError(handler func(RecordedError)) {
+	traceErrorHandlers = append(traceErrorHandlers, handler)
+}
+
+// AddTraceError записывает ошибку в открытый трейс. Без явного span ошибка относится к текущему span трейса.
+func AddTraceError(cfg *config.Config, pid string, traceId string, traceError TraceError) error {
+	value, isExist := dataCollection.Load(pid)
+	if !isExist {
+		return fmt.Errorf("skip trace error. trace is not initialized")
+	}
+	traceData := *value.(**dataStruct)
+	if !isTraceIdIdentical(traceData, traceId) {
+		return fmt.Errorf("skip trace error. trace id mismatch")
+	}
+	if traceError.Span == "" {
+		traceError.Span = GetCurrentSpanName(pid)
+	}
+	if cfg.Redaction.OnIngestion {
+		redactTraceError(&traceError)
+	}
+	if len(traceData.Errors) >= maxTraceErrors {
+		traceData.Errors = traceData.Errors[1:]
+	}
+	traceData.Errors = append(traceData.Errors, traceError)
+	storeTraceData(cfg, pid, traceData)
+	TotalTraceErrors.Increment()
+
+	recordedError := RecordedError{
+		App:       traceData.App,
+		Pid:       traceData.Pid,
+		TraceId:   traceData.TraceId,
+		Error:     traceError,
+		TagValues: tagsOf(traceData),
+	}
+	for _, handler := range traceErrorHandlers {
+		handler(recordedError)
+	}
+
+	return nil
+}
+
+func redactTraceError(traceError *TraceError) {
+	traceError.Message, _ = Redactor.Redact(traceError.Message, "error", "message").(string)
+	if traceError.Backtrace == nil {
+		return
+	}
+	var backtrace interface{}
+	if err := json.Unmarshal(traceError.Backtrace, &backtrace); err != nil {
+		return
+	}
+	if backtraceBytes, err := json.Marshal(Redactor.Redact(backtrace, "error", "backtrace")); err == nil {
+		traceError.Backtrace = backtraceBytes
+	}
+}
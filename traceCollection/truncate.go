@@ -0,0 +1,106 @@
+package traceCollection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"trace-monitor-collector/config"
+	"trace-monitor-collector/counter"
+	"unicode/utf8"
+)
+
+var (
+	TotalTruncatedFields counter.CounterStruct
+)
+
+// truncateFields укорачивает поля из cfg.TruncateFields, которые занимают больше cfg.MaxFieldBytes.
+// У массивов остаются первые элементы, у строк начало, объекты заменяются отметкой о размере.
+func truncateFields(cfg *config.Config, data []byte) []byte {
+	if cfg.MaxFieldBytes <= 0 || len(data) <= cfg.MaxFieldBytes || len(cfg.TruncateFields) == 0 {
+		return data
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var command interface{}
+	if err := decoder.Decode(&command); err != nil {
+		return data
+	}
+	if !truncateValue(cfg, command) {
+		return data
+	}
+	truncated, err := json.Marshal(command)
+	if err != nil {
+		return data
+	}
+	return truncated
+}
+
+func truncateValue(cfg *config.Config, value interface{}) bool {
+	isTruncated := false
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typedValue {
+			if isTruncateField(cfg, key) {
+				if truncatedChild, ok := truncateField(child, cfg.MaxFieldBytes); ok {
+					typedValue[key] = truncatedChild
+					TotalTruncatedFields.Increment()
+					isTruncated = true
+					continue
+				}
+			}
+			if truncateValue(cfg, child) {
+				isTruncated = true
+			}
+		}
+	case []interface{}:
+		for _, child := range typedValue {
+			if truncateValue(cfg, child) {
+				isTruncated = true
+			}
+		}
+	}
+	return isTruncated
+}
+
+func isTruncateField(cfg *config.Config, key string) bool {
+	for _, field := range cfg.TruncateFields {
+		if field == key {
+			return true
+		}
+	}
+	return false
+}
+
+func encodedSize(value interface{}) int {
+	encoded, _ := json.Marshal(value)
+	return len(encoded)
+}
+
+func truncateField(value interface{}, maxBytes int) (interface{}, bool) {
+	size := encodedSize(value)
+	if size <= maxBytes {
+		return value, false
+	}
+	switch typedValue := value.(type) {
+	case []interface{}:
+		kept := make([]interface{}, 0)
+		keptSize := 0
+		for _, item := range typedValue {
+			itemSize := encodedSize(item)
+			if keptSize+itemSize > maxBytes {
+				break
+			}
+			kept = append(kept, item)
+			keptSize += itemSize
+		}
+		return append(kept, fmt.Sprintf("... %d more items truncated", len(typedValue)-len(kept))), true
+	case string:
+		// Экранирование в JSON раздувает строку, поэтому режем пропорционально закодированному размеру
+		cut := maxBytes * len(typedValue) / size
+		for cut > 0 && !utf8.RuneStart(typedValue[cut]) {
+			cut--
+		}
+		return typedValue[:cut] + "... truncated", true
+	}
+	return fmt.Sprintf("truncated: %d bytes", size), true
+}
@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"time"
 	"trace-monitor-collector/command"
 	"trace-monitor-collector/config"
 	"trace-monitor-collector/counter"
+	"trace-monitor-collector/logger"
+	"trace-monitor-collector/reorder"
+	"trace-monitor-collector/skew"
+	"trace-monitor-collector/stream"
 	"trace-monitor-collector/traceCollection"
 )
 
@@ -18,44 +23,65 @@ var (
 	totalPackagesCaught counter.CounterStruct
 	totalPackagesParse  counter.CounterStruct
 	totalChannelReset   counter.CounterStruct
-	channelList         []chan []byte
+	channelList         []chan udpPacket
 	start               time.Time
-	udpServerReadyChan  = make(chan struct{})
+	udpServerReadyChan  = make(chan struct{}, 1)
+	reorderBuffer       *reorder.Buffer
+	clockSkew           *skew.Tracker
+
+	udpLog = logger.New("udp")
 )
 
+type udpPacket struct {
+	data       []byte
+	receivedAt time.Time
+	source     string
+}
+
 func handleUdp(ctx context.Context, cfg *config.Config) {
 	defer recoverRoutineHandleUdp(ctx, cfg)
 
-	channelList = make([]chan []byte, cfg.UdpPortRangeCount)
+	channelList = make([]chan udpPacket, cfg.UdpPortRangeCount)
+	clockSkew = skew.New(time.Duration(cfg.ClockSkewWarnMs) * time.Millisecond)
 
 	for port := cfg.UdpPortStart; port <= cfg.UdpPortEnd; port++ {
 		localPort := port
 		localChannelKey := port - cfg.UdpPortStart
 
-		channelList[localChannelKey] = make(chan []byte, cfg.PacketsSize)
+		channelList[localChannelKey] = make(chan udpPacket, cfg.PacketsSize)
 		addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", localPort))
 		if err != nil {
-			log.Printf("Error resolving UDP address: %v", err)
+			udpLog.Error("resolving UDP address", "port", localPort, "err", err)
 			os.Exit(1)
 		}
 		udpConn, err := net.ListenUDP("udp", addr)
 		if err != nil {
-			log.Printf("Error listening on UDP port %d: %v", localPort, err)
+			udpLog.Error("listening on UDP port", "port", localPort, "err", err)
 			os.Exit(1)
 		}
 		defer udpConn.Close()
+		udpListenersBound.Increment()
 
-		if cfg.IsVerboseByLevel("v") {
-			log.Println("UDP listener started on", localPort)
-		}
+		udpLog.Info("UDP listener started", "port", localPort)
 		go channelWriter(cfg, localChannelKey, udpConn)
 	}
 
+	if cfg.ReorderWindowMs > 0 {
+		reorderBuffer = reorder.New(time.Duration(cfg.ReorderWindowMs)*time.Millisecond, func(channelKey int, cmd command.Command) {
+			applyReorderedCommand(cfg, channelKey, cmd)
+		})
+		go reorderBuffer.Run(ctx)
+	}
+
 	channelReader(cfg)
 
-	udpServerReadyChan <- struct{}{}
+	// Готовность ждут только тесты, поэтому без получателя не блокируемся
+	select {
+	case udpServerReadyChan <- struct{}{}:
+	default:
+	}
 
-	if cfg.IsVerboseByLevel("vv") {
+	if udpLog.Enabled(logger.LevelDebug) {
 		var lastValue uint64 = 0
 		var clearIter int = 0
 		var startTotalPackagesCaught uint64 = 0
@@ -73,8 +99,7 @@ func handleUdp(ctx context.Context, cfg *config.Config) {
 			} else {
 				elapsed := time.Since(start).Milliseconds()
 				rps := (float64(localTotalPackagesCaught) / float64(elapsed)) * 1000
-				log.Println(localTotalPackagesCaught, " / ", localTotalPackagesParse, " : ", elapsed)
-				log.Printf("RPS: %.2f\n", rps)
+				udpLog.Debug("packets processed", "caught", localTotalPackagesCaught, "parsed", localTotalPackagesParse, "elapsedMs", elapsed, "rps", fmt.Sprintf("%.2f", rps))
 				clearIter = 0
 			}
 
@@ -85,12 +110,7 @@ func handleUdp(ctx context.Context, cfg *config.Config) {
 		for {
 			select {
 			case <-ctx.Done():
-				totalPackagesCaught.Reset()
-				totalPackagesParse.Reset()
-				traceCollection.TotalAllSpanClose.Reset()
-				traceCollection.TotalTraceSet.Reset()
-				traceCollection.TotalSpanSet.Reset()
-				traceCollection.TotalTraceDelete.Reset()
+				resetCounters()
 				return
 			default:
 				time.Sleep(time.Second)
@@ -99,44 +119,59 @@ func handleUdp(ctx context.Context, cfg *config.Config) {
 	}
 }
 
+// resetCounters обнуляет счётчики пакетов и команд при остановке приёма и по /admin/reset-counters
+func resetCounters() {
+	totalPackagesCaught.Reset()
+	totalPackagesParse.Reset()
+	traceCollection.ResetCounters()
+}
+
 func channelWriter(cfg *config.Config, localChannelKey int, udpConn *net.UDPConn) {
+	defer udpListenersBound.Decrement()
+
 	buffer := make([]byte, cfg.Buffer)
 	for {
-		n, _, err := udpConn.ReadFromUDP(buffer)
+		n, remoteAddr, err := udpConn.ReadFromUDP(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			udpLog.Warn("UDP listener closed", "channel", localChannelKey)
+			return
+		}
 		if err != nil {
 			continue
 		}
+		receivedAt := time.Now()
+		observePacketSize(n)
 
-		if cfg.IsVerboseByLevel("vv") {
+		if udpLog.Enabled(logger.LevelDebug) {
 			if totalPackagesCaught.Count() == 0 {
 				start = time.Now()
 			}
 			cmd, _ := command.FromJson(buffer[:n])
-			log.Println("write:",
-				localChannelKey,
-				cmd.Pid,
-				cmd.Method,
-				cmd.TraceId,
-				cmd.SentAt)
+			udpLog.Debug("write", "channel", localChannelKey, "pid", cmd.Pid, "method", cmd.Method, "traceId", cmd.TraceId, "sentAt", cmd.SentAt)
 		}
-		if cfg.IsVerboseByLevel("vvv") {
-			log.Println("packet:", localChannelKey, string(buffer[:n]))
+		if udpLog.Enabled(logger.LevelTrace) {
+			udpLog.Trace("packet", "channel", localChannelKey, "data", buffer[:n])
 		}
 
-		packet := make([]byte, n)
-		copy(packet, buffer[:n])
+		packet := udpPacket{
+			data:       make([]byte, n),
+			receivedAt: receivedAt,
+		}
+		copy(packet.data, buffer[:n])
+		// Порт у клиента эфемерный, поэтому источник различаем только по адресу
+		if remoteAddr != nil {
+			packet.source = remoteAddr.IP.String()
+		}
 
 		if err := pushToChannal(localChannelKey, packet); err != nil {
-			if cfg.IsVerboseByLevel("v") {
-				log.Println("_warn:", localChannelKey, err)
-			}
+			udpLog.WarnLimited("push", "packet dropped", "channel", localChannelKey, "err", err)
 		}
 
 		totalPackagesCaught.Increment()
 	}
 }
 
-func pushToChannal(channelKey int, packet []byte) error {
+func pushToChannal(channelKey int, packet udpPacket) error {
 	select {
 	case channelList[channelKey] <- packet:
 		return nil
@@ -156,7 +191,9 @@ func pushToChannal(channelKey int, packet []byte) error {
 func channelReader(cfg *config.Config) {
 	for channelKey, channel := range channelList {
 		localChannelKey := channelKey
-		go func(localChannelKey int, channel chan []byte) {
+		go func(localChannelKey int, channel chan udpPacket) {
+			udpReadersAlive.Increment()
+			defer udpReadersAlive.Decrement()
 			for packet := range channel {
 				processUdpPacket(cfg, localChannelKey, packet)
 			}
@@ -164,59 +201,160 @@ func channelReader(cfg *config.Config) {
 	}
 }
 
-func processUdpPacket(cfg *config.Config, channelKey int, packet []byte) {
+func processUdpPacket(cfg *config.Config, channelKey int, packet udpPacket) {
 	defer recoverPackageProcess()
+	startedAt := time.Now()
+	defer observeSince(packetProcessTime, startedAt)
+	if !packet.receivedAt.IsZero() {
+		observeDuration(packetQueueWait, startedAt.Sub(packet.receivedAt))
+	}
 
-	cmd, err := command.FromJson(packet)
+	cmd, err := command.FromJson(packet.data)
+	observeSince(packetParseTime, startedAt)
 	if err != nil {
 		// TODO: log or return
 	}
+	cmd.ReceivedAt = packet.receivedAt
+	cmd.Source = packet.source
+	// Своё приложение коллектора не отличаем от пакетов без app, иначе у метрик задвоятся серии
+	if cmd.App == cfg.AppName {
+		cmd.App = ""
+	}
+	if err == nil {
+		observeClockSkew(cfg, cmd)
+	}
 
-	if err := applyUdpCommand(cfg, channelKey, cmd); err != nil {
-		if cfg.IsVerboseByLevel("v") {
-			log.Println("_warn:", channelKey, err)
-		}
+	if err == nil && reorderBuffer != nil {
+		reorderBuffer.Push(channelKey, cmd)
+	} else if err := applyUdpCommand(cfg, channelKey, cmd); err != nil {
+		udpLog.WarnLimited("apply", "command not applied", "channel", channelKey, "pid", cmd.Pid, "method", cmd.Method, "err", err)
 	}
 
 	totalPackagesParse.Increment()
 }
 
+func observeClockSkew(cfg *config.Config, cmd command.Command) {
+	if clockSkew == nil {
+		return
+	}
+	offset, isExceeded, isChanged := clockSkew.Observe(cmd.Source, cmd.SentAt, cmd.ReceivedAt)
+	if !isChanged {
+		return
+	}
+	if isExceeded {
+		udpLog.Warn("clock skew exceeded", "source", cmd.Source, "offset", offset, "threshold", time.Duration(cfg.ClockSkewWarnMs)*time.Millisecond)
+	} else {
+		udpLog.Info("clock skew is back to normal", "source", cmd.Source, "offset", offset)
+	}
+}
+
+func applyReorderedCommand(cfg *config.Config, channelKey int, cmd command.Command) {
+	defer recoverPackageProcess()
+
+	if err := applyUdpCommand(cfg, channelKey, cmd); err != nil {
+		udpLog.WarnLimited("apply", "command not applied", "channel", channelKey, "pid", cmd.Pid, "method", cmd.Method, "err", err)
+	}
+}
+
 func applyUdpCommand(cfg *config.Config, channelKey int, cmd command.Command) error {
-	if cfg.IsVerboseByLevel("vv") {
-		log.Println("_read:", channelKey, cmd.Pid, cmd.Method, cmd.TraceId, cmd.SentAt)
+	udpLog.Debug("read", "channel", channelKey, "pid", cmd.Pid, "method", cmd.Method, "traceId", cmd.TraceId, "sentAt", cmd.SentAt)
+	if udpLog.Enabled(logger.LevelTrace) {
+		udpLog.Trace("data", "channel", channelKey, "data", []byte(cmd.Data))
 	}
-	if cfg.IsVerboseByLevel("vvv") {
-		log.Println("_data:", channelKey, string(cmd.Data))
+	// Событие собираем до применения команды, чтобы free-pid ещё видел теги трейса
+	var event *stream.Event
+	if stream.HasSubscribers() {
+		event = buildStreamEvent(cfg, cmd)
 	}
-	if cmd.Method == "init-trace" {
-		return traceCollection.InitTrace(cfg, cmd.Pid, cmd.TraceId, cmd.SentAt, cmd.RawCommand)
+	err := applyCommandToCollection(cfg, cmd)
+	// Пропуски в seq считаем и для отброшенных команд: пакет всё равно дошёл до коллектора
+	traceCollection.TrackSeq(processKeyOf(cmd), cmd.TraceId, cmd.Seq)
+	if err != nil {
+		return err
+	}
+	if event != nil {
+		stream.Publish(*event)
+	}
+
+	return nil
+}
+
+// appNameOf возвращает имя приложения для вывода: пакеты без app принадлежат приложению из конфига
+func appNameOf(cfg *config.Config, app string) string {
+	if app == "" {
+		return cfg.AppName
 	}
-	if cmd.Method == "set-trace-current-span" {
+	return app
+}
+
+func processKeyOf(cmd command.Command) string {
+	return traceCollection.ProcessKey(cmd.App, cmd.Host, cmd.Pid)
+}
+
+func buildStreamEvent(cfg *config.Config, cmd command.Command) *stream.Event {
+	event := &stream.Event{
+		Type:    cmd.Method,
+		App:     appNameOf(cfg, cmd.App),
+		Host:    cmd.Host,
+		Pid:     cmd.Pid,
+		TraceId: cmd.TraceId,
+		SentAt:  cmd.SentAt,
+		Data:    cmd.Data,
+	}
+	var data struct {
+		Span struct {
+			Name string `json:"name"`
+		} `json:"span"`
+		Tags map[string]interface{} `json:"tags"`
+	}
+	if cmd.Data != nil {
+		json.Unmarshal(cmd.Data, &data)
+	}
+	switch cmd.Method {
+	case "init-trace":
+		event.Type = stream.EventInitTrace
+		event.Tags = data.Tags
+	case "set-trace-current-span":
+		event.Type = stream.EventSpanSet
 		if cmd.Data == nil {
-			return traceCollection.DeleteSpan(cfg, cmd.Pid, cmd.TraceId, cmd.SentAt)
+			event.Type = stream.EventSpanClose
+			event.SpanName = traceCollection.GetCurrentSpanName(processKeyOf(cmd))
 		} else {
-			return traceCollection.SetTraceCurrentSpan(cfg, cmd.Pid, cmd.TraceId, cmd.SentAt, cmd.RawCommand)
+			event.SpanName = data.Span.Name
 		}
+		event.Tags = traceCollection.GetTraceTags(processKeyOf(cmd))
+	case "free-pid":
+		event.Type = stream.EventFreePid
+		event.Tags = traceCollection.GetTraceTags(processKeyOf(cmd))
+	case "set-trace-tags":
+		event.Tags = data.Tags
+	default:
+		event.Tags = traceCollection.GetTraceTags(processKeyOf(cmd))
 	}
-	if cmd.Method == "free-pid" {
-		return traceCollection.DeleteTrace(cfg, cmd.Pid, cmd.TraceId, cmd.SentAt)
+	// Событие собирается из сырого пакета, поэтому маскируем его при любом режиме редакции:
+	// иначе в поток уйдут значения, которые on_ingestion убрал из хранилища
+	if cfg.Redaction.OnIngestion || cfg.Redaction.OnOutput {
+		if event.Data != nil {
+			event.Data = redactRawData(event.Data)
+		}
+		if event.Tags != nil {
+			event.Tags, _ = traceCollection.Redactor.Redact(event.Tags, "tags").(map[string]interface{})
+		}
 	}
-
-	return fmt.Errorf("unknown method specified in UDP packet. %v", cmd.Method)
+	return event
 }
 
 func recoverRoutineHandleUdp(ctx context.Context, cfg *config.Config) {
 	if r := recover(); r != nil {
-		log.Println("Handle UDP error: ", r)
-		if cfg.IsVerboseByLevel("v") {
-			log.Println("Last package: ", lastPackage)
-		}
+		routinePanics[routineUdp].Increment()
+		udpLog.Error("handle UDP panic", "panic", r, "lastPackage", lastPackage)
 		go handleUdp(ctx, cfg)
 	}
 }
 
 func recoverPackageProcess() {
 	if r := recover(); r != nil {
-		log.Println("Package process error: ", r)
+		totalPacketPanics.Increment()
+		udpLog.Error("package process panic", "panic", r)
 	}
 }
@@ -5,7 +5,9 @@ import (
 	"net"
 	"testing"
 	"time"
+	"trace-monitor-collector/command"
 	"trace-monitor-collector/config"
+	"trace-monitor-collector/redaction"
 	"trace-monitor-collector/traceCollection"
 
 	"github.com/stretchr/testify/assert"
@@ -124,3 +126,26 @@ func udpServerConfig(port int) *config.Config {
 		HttpClientTimeout:    3,
 	}
 }
+
+func TestStreamEventIsRedactedWhenOnlyIngestionRedactionIsOn(t *testing.T) {
+	// Arrange
+	cfg := &config.Config{AppName: "app-name", Redaction: config.Redaction{OnIngestion: true, Keys: []string{"token"}, Mask: "***"}}
+	redactor, err := redaction.New(cfg.Redaction)
+	require.Nil(t, err)
+	previousRedactor := traceCollection.Redactor
+	defer func() { traceCollection.Redactor = previousRedactor }()
+	traceCollection.Redactor = redactor
+	cmd := command.Command{
+		Pid:     "970",
+		Method:  "init-trace",
+		TraceId: "stream-trace",
+		Data:    []byte(`{"tags":{"token":"secret","service":"checkout"},"serverContext":{"token":"secret"}}`),
+	}
+
+	// Act
+	event := buildStreamEvent(cfg, cmd)
+
+	// Assert
+	assert.Equal(t, map[string]interface{}{"token": "***", "service": "checkout"}, event.Tags)
+	assert.JSONEq(t, `{"tags":{"token":"***","service":"checkout"},"serverContext":{"token":"***"}}`, string(event.Data))
+}
@@ -0,0 +1,258 @@
+(function () {
+    "use strict";
+
+    var state = {
+        rows: [],
+        stats: {},
+        sortKey: "elapsedMs",
+        sortAsc: false,
+        selectedPid: null,
+        timer: null
+    };
+
+    var tbody = document.querySelector("#traces tbody");
+    var filterInput = document.getElementById("filter");
+    var onlyStuckInput = document.getElementById("only-stuck");
+    var refreshSelect = document.getElementById("refresh-interval");
+    var statusBar = document.getElementById("status");
+
+    function text(value) {
+        if (value === null || value === undefined) {
+            return "";
+        }
+        return String(value);
+    }
+
+    function formatDuration(ms) {
+        if (ms < 1000) {
+            return ms.toFixed(0) + "ms";
+        }
+        if (ms < 60000) {
+            return (ms / 1000).toFixed(2) + "s";
+        }
+        var minutes = Math.floor(ms / 60000);
+        return minutes + "m" + ((ms % 60000) / 1000).toFixed(0) + "s";
+    }
+
+    function tagsToText(tags) {
+        if (!tags || typeof tags !== "object") {
+            return "";
+        }
+        return Object.keys(tags).map(function (key) {
+            return key + "=" + (typeof tags[key] === "object" ? JSON.stringify(tags[key]) : tags[key]);
+        }).join(", ");
+    }
+
+    function toRow(pid, info) {
+        var trace = info.trace || {};
+        var span = (info.span && info.span.span) || {};
+        var serverContext = trace.serverContext || {};
+        return {
+            key: pid,
+            pid: text(info.pid || pid),
+            app: text(info.app),
+            pool: text(info.pool),
+            elapsedMs: info.elapsedMs || 0,
+            traceId: text(info.traceId),
+            spanName: text(span.name),
+            uri: text(serverContext.uri),
+            tagsText: tagsToText(info.tags),
+            info: info
+        };
+    }
+
+    function stuckThresholdMs(row) {
+        var general = state.stats._ || {};
+        return (row.info.stuckProcessDuration || general.stuckProcessDuration || 0) * 1000;
+    }
+
+    function isStuck(row) {
+        var threshold = stuckThresholdMs(row);
+        return threshold > 0 && row.elapsedMs >= threshold;
+    }
+
+    function visibleRows() {
+        var filter = filterInput.value.trim().toLowerCase();
+        var onlyStuck = onlyStuckInput.checked;
+        return state.rows.filter(function (row) {
+            if (onlyStuck && !isStuck(row)) {
+                return false;
+            }
+            if (filter === "") {
+                return true;
+            }
+            return [row.pid, row.app, row.pool, row.traceId, row.spanName, row.uri, row.tagsText].some(function (value) {
+                return value.toLowerCase().indexOf(filter) !== -1;
+            });
+        }).sort(function (a, b) {
+            var left = a[state.sortKey];
+            var right = b[state.sortKey];
+            var result = typeof left === "number" ? left - right : left.localeCompare(right, undefined, {numeric: true});
+            return state.sortAsc ? result : -result;
+        });
+    }
+
+    function renderSummary() {
+        var summary = document.getElementById("summary");
+        summary.textContent = "";
+        var general = state.stats._ || {};
+        var gauge = state.stats.gauge || {};
+        var totalCounts = state.stats.totalCounts || {};
+        var items = [
+            ["active pids", gauge.countActivePid],
+            ["stuck", state.rows.filter(isStuck).length],
+            ["packages caught", totalCounts.packagesCaught],
+            ["channel resets", totalCounts.totalChannelReset],
+            ["version", general.appVersion]
+        ];
+        items.forEach(function (item) {
+            var span = document.createElement("span");
+            var label = document.createElement("b");
+            label.textContent = item[0] + ": ";
+            span.appendChild(label);
+            span.appendChild(document.createTextNode(text(item[1])));
+            summary.appendChild(span);
+        });
+    }
+
+    function renderTable() {
+        var rows = visibleRows();
+        tbody.textContent = "";
+        rows.forEach(function (row) {
+            var tr = document.createElement("tr");
+            if (isStuck(row)) {
+                tr.className = "stuck";
+            }
+            if (row.key === state.selectedPid) {
+                tr.className += " selected";
+            }
+            [row.pid, row.app, row.pool, formatDuration(row.elapsedMs), row.traceId, row.spanName, row.uri, row.tagsText].forEach(function (value) {
+                var td = document.createElement("td");
+                td.textContent = value;
+                td.title = value;
+                tr.appendChild(td);
+            });
+            tr.addEventListener("click", function () {
+                state.selectedPid = row.key;
+                renderTable();
+                renderDetails();
+            });
+            tbody.appendChild(tr);
+        });
+        document.getElementById("empty").hidden = rows.length > 0;
+    }
+
+    function renderJson(value, key, isOpen) {
+        var keyNode = document.createElement("span");
+        keyNode.className = "key";
+        keyNode.textContent = key === null ? "" : key + ": ";
+
+        if (value !== null && typeof value === "object") {
+            var isArray = Array.isArray(value);
+            var keys = Object.keys(value);
+            var details = document.createElement("details");
+            details.open = isOpen;
+            var summary = document.createElement("summary");
+            summary.appendChild(keyNode);
+            summary.appendChild(document.createTextNode(isArray ? "[" + keys.length + "]" : "{" + keys.length + "}"));
+            details.appendChild(summary);
+            keys.forEach(function (childKey) {
+                details.appendChild(renderJson(value[childKey], childKey, false));
+            });
+            return details;
+        }
+
+        var entry = document.createElement("div");
+        entry.className = "entry";
+        entry.appendChild(keyNode);
+        var valueNode = document.createElement("span");
+        valueNode.className = value === null ? "null" : typeof value;
+        valueNode.textContent = typeof value === "string" ? JSON.stringify(value) : text(value === null ? "null" : value);
+        entry.appendChild(valueNode);
+        return entry;
+    }
+
+    function renderDetails() {
+        var details = document.getElementById("details");
+        var row = state.rows.find(function (item) {
+            return item.key === state.selectedPid;
+        });
+        if (!row) {
+            details.hidden = true;
+            return;
+        }
+        details.hidden = false;
+        document.getElementById("details-title").textContent = "PID " + row.pid + " — " + row.traceId;
+        var body = document.getElementById("details-body");
+        body.textContent = "";
+        var json = document.createElement("div");
+        json.className = "json";
+        json.appendChild(renderJson(row.info, null, true));
+        body.appendChild(json);
+    }
+
+    function load() {
+        return fetch("/getall.json", {credentials: "same-origin", cache: "no-store"})
+            .then(function (response) {
+                if (!response.ok) {
+                    throw new Error("HTTP " + response.status);
+                }
+                return response.json();
+            })
+            .then(function (data) {
+                state.stats = data.stats || {};
+                state.rows = Object.keys(data.trace || {}).map(function (pid) {
+                    return toRow(pid, data.trace[pid]);
+                });
+                renderSummary();
+                renderTable();
+                renderDetails();
+                statusBar.className = "";
+                statusBar.textContent = "Updated " + new Date().toLocaleTimeString();
+            })
+            .catch(function (error) {
+                statusBar.className = "error";
+                statusBar.textContent = "Update failed: " + error.message;
+            });
+    }
+
+    function schedule() {
+        if (state.timer) {
+            clearInterval(state.timer);
+            state.timer = null;
+        }
+        var interval = parseInt(refreshSelect.value, 10);
+        if (interval > 0) {
+            state.timer = setInterval(load, interval);
+        }
+    }
+
+    document.querySelectorAll("#traces th").forEach(function (th) {
+        th.addEventListener("click", function () {
+            var key = th.getAttribute("data-sort");
+            if (state.sortKey === key) {
+                state.sortAsc = !state.sortAsc;
+            } else {
+                state.sortKey = key;
+                state.sortAsc = key !== "elapsedMs";
+            }
+            document.querySelectorAll("#traces th").forEach(function (other) {
+                other.className = "";
+            });
+            th.className = "sorted " + (state.sortAsc ? "asc" : "desc");
+            renderTable();
+        });
+    });
+    filterInput.addEventListener("input", renderTable);
+    onlyStuckInput.addEventListener("change", renderTable);
+    refreshSelect.addEventListener("change", schedule);
+    document.getElementById("refresh-now").addEventListener("click", load);
+    document.getElementById("details-close").addEventListener("click", function () {
+        state.selectedPid = null;
+        renderTable();
+        renderDetails();
+    });
+
+    load();
+    schedule();
+})();